@@ -2,60 +2,236 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/marvel-forwarder/data/migrations"
+	models "github.com/kagelui/marvel-forwarder/internal/models/characters"
+	"github.com/kagelui/marvel-forwarder/internal/models/schema"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/database"
 	"github.com/kagelui/marvel-forwarder/internal/pkg/envvar"
 	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/metrics"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/ops"
 	"github.com/kagelui/marvel-forwarder/internal/service/marvel"
+	"github.com/kagelui/marvel-forwarder/internal/service/snapshot"
 	_ "github.com/lib/pq"
 )
 
-const retries = 3
+const (
+	retries = 3
+	// requestTimeout bounds each request to Marvel, so that a hung one fails the sync rather than blocking it
+	requestTimeout = 30 * time.Second
+	// pushTimeout bounds the push of the metrics
+	pushTimeout = 10 * time.Second
+)
+
+const usage = `usage: bifrost [flags] [command]
+
+Mirrors the characters of the Marvel API into DATABASE_URL.
+
+commands:
+  sync          fetch the characters from MARVEL_API_URL and save them, the default
+  export DIR    write the catalogue to DIR as NDJSON along with a manifest.json
+  import DIR    replace the catalogue with the snapshot in DIR, once its manifest and checksums are checked
+
+flags:
+`
+
+var lastSuccess = metrics.NewGauge("bifrost_last_success_timestamp_seconds",
+	"When bifrost last synced the characters successfully, in seconds since the epoch.")
 
 func main() {
+	migrate := flag.Bool("migrate", false, "run the pending migrations, instead of refusing to start should there be any")
+	envFile := flag.String("env-file", "", "a .env file of defaults for the env vars, which take precedence over it")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	lg := loglib.DefaultLogger()
 	ctx := loglib.SetLogger(context.Background(), lg)
+	build := ops.CurrentBuild()
+	lg.InfoF("bifrost %s, commit %s, built %s with %s", build.Version, build.Commit, build.BuildTime, build.GoVersion)
+
+	src, err := envvar.WithDotenv(*envFile)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+
+	switch cmd := flag.Arg(0); cmd {
+	case "", "sync":
+	case "export", "import":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		var e dbVar
+		if err := envvar.ReadFrom(src, &e); err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(1)
+		}
+		lg.InfoF("config:\n%s", envvar.Format(&e))
+		if cmd == "export" {
+			os.Exit(runExport(ctx, e, *migrate, flag.Arg(1)))
+		}
+		os.Exit(runImport(ctx, e, *migrate, flag.Arg(1)))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 
 	lg.InfoF("starting syncing with marvel API...")
 
 	var e envVar
 
-	if err := envvar.Read(&e); err != nil {
+	if err := envvar.ReadFrom(src, &e); err != nil {
 		lg.ErrorF(err.Error())
 		os.Exit(1)
 	}
+	lg.InfoF("config:\n%s", envvar.Format(&e))
+
+	code := run(ctx, e, *migrate)
+	if e.PushgatewayURL != "" {
+		if err := pushMetrics(ctx, e.PushgatewayURL); err != nil {
+			lg.ErrorF("pushing metrics: %s", err)
+		}
+	}
+	os.Exit(code)
+}
+
+// run syncs the characters with marvel, returning the exit code
+func run(ctx context.Context, e envVar, migrate bool) int {
+	lg := loglib.GetLogger(ctx)
 
 	client := marvel.ApiClient{
-		Client:     http.DefaultClient,
+		Client:     &http.Client{Timeout: requestTimeout},
 		PublicKey:  e.PublicKey,
 		PrivateKey: e.PrivateKey,
 		APIAddr:    e.APIAddr,
 		Retries:    retries,
 	}
 
-	db, err := sqlx.Connect("postgres", e.DBAddr)
+	db, code := connect(ctx, e.DB, migrate)
+	if db == nil {
+		return code
+	}
+
+	characters, err := client.RetrieveCharacters(ctx)
 	if err != nil {
 		lg.ErrorF(err.Error())
-		os.Exit(2)
+		return 3
 	}
 
-	characters, err := client.RetrieveCharacters(ctx)
+	repo := &models.Postgres{DB: db}
+	if err = repo.SaveSync(ctx, characters); err != nil {
+		lg.ErrorF(err.Error())
+		return 4
+	}
+	lastSuccess.Set(float64(time.Now().Unix()))
+
+	// serverd caches are dropped after their TTL anyway, so a failed notification is not fatal
+	if err = models.NotifySynced(ctx, db); err != nil {
+		lg.ErrorF(err.Error())
+	}
+	return 0
+}
+
+// connect connects to the DB and ensures its migrations, returning the exit code should it fail
+func connect(ctx context.Context, e dbVar, migrate bool) (*sqlx.DB, int) {
+	lg := loglib.GetLogger(ctx)
+
+	db, err := database.Connect(e.DBAddr, e.Pool)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		return nil, 2
+	}
+
+	migrator, err := schema.NewMigrator(db, migrations.FS)
+	if err == nil {
+		err = migrator.Ensure(ctx, migrate)
+	}
+	if err != nil {
+		lg.ErrorF(err.Error())
+		return nil, 5
+	}
+	return db, 0
+}
+
+// runExport writes the catalogue to dir, returning the exit code
+func runExport(ctx context.Context, e dbVar, migrate bool, dir string) int {
+	lg := loglib.GetLogger(ctx)
+
+	db, code := connect(ctx, e, migrate)
+	if db == nil {
+		return code
+	}
+
+	m, err := snapshot.Export(ctx, &models.Postgres{DB: db}, dir)
 	if err != nil {
 		lg.ErrorF(err.Error())
-		os.Exit(3)
+		return 6
 	}
+	lg.InfoF("exported %d characters to %s, %s", m.Resources[snapshot.ResourceCharacters].Count, dir, watermark(m))
+	return 0
+}
+
+// runImport replaces the catalogue with the snapshot in dir, returning the exit code
+func runImport(ctx context.Context, e dbVar, migrate bool, dir string) int {
+	lg := loglib.GetLogger(ctx)
+
+	db, code := connect(ctx, e, migrate)
+	if db == nil {
+		return code
+	}
+
+	m, err := snapshot.Import(ctx, &models.Postgres{DB: db}, dir)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		return 6
+	}
+	lg.InfoF("imported %d characters from %s, %s", m.Resources[snapshot.ResourceCharacters].Count, dir, watermark(m))
 
-	if err = characters.Save(ctx, db); err != nil {
+	if err = models.NotifySynced(ctx, db); err != nil {
 		lg.ErrorF(err.Error())
-		os.Exit(4)
 	}
+	return 0
+}
+
+// watermark describes the sync the snapshot comes from
+func watermark(m snapshot.Manifest) string {
+	if m.Watermark == nil {
+		return "never synced"
+	}
+	return fmt.Sprintf("synced at %s", m.Watermark.CompletedAt.Format(time.RFC3339))
+}
+
+// pushMetrics pushes the metrics to the Pushgateway, as bifrost does not live long enough to be scraped.
+// The last success is only pushed on success, so that the gateway keeps the previous one on failure
+func pushMetrics(ctx context.Context, gatewayURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	return metrics.Default.Push(ctx, http.DefaultClient, gatewayURL, "bifrost")
 }
 
 type envVar struct {
 	PublicKey  string `env:"PUBLIC_KEY"`
-	PrivateKey string `env:"PRIVATE_KEY"`
-	APIAddr    string `env:"MARVEL_API_URL"`
-	DBAddr     string `env:"DATABASE_URL"`
+	PrivateKey string `env:"PRIVATE_KEY,secret"`
+	APIAddr    string `env:"MARVEL_API_URL,url"`
+	DB         dbVar  `env:""`
+	// PushgatewayURL is the Prometheus Pushgateway the metrics are pushed to, not done if empty
+	PushgatewayURL string `env:"METRICS_PUSHGATEWAY_URL,optional,url"`
+}
+
+// dbVar is all export and import need
+type dbVar struct {
+	DBAddr string `env:"DATABASE_URL,secret"`
+	// Pool is the config of the connection pool, e.g. DATABASE_MAX_OPEN_CONNS
+	Pool database.Pool `env:"DATABASE"`
 }
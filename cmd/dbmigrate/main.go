@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/marvel-forwarder/data/migrations"
+	"github.com/kagelui/marvel-forwarder/internal/models/schema"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/envvar"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage: dbmigrate [-env-file .env] <command>
+
+Runs the migrations embedded from data/migrations against DATABASE_URL.
+
+commands:
+  up          apply the pending migrations
+  down [N]    revert the latest N migrations, 1 by default
+  version     print the version of the DB, and whether it is dirty
+  force V     set the version to V without running any migration, once a dirty one is fixed by hand
+
+flags:
+`
+
+func main() {
+	lg := loglib.DefaultLogger()
+	ctx := loglib.SetLogger(context.Background(), lg)
+
+	envFile := flag.String("env-file", "", "a .env file of defaults for the env vars, which take precedence over it")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src, err := envvar.WithDotenv(*envFile)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+
+	var e envVar
+	if err := envvar.ReadFrom(src, &e); err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+
+	db, err := sqlx.Connect("postgres", e.DBAddr)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	m, err := schema.NewMigrator(db, migrations.FS)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+
+	if err = run(ctx, m, flag.Args()); err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, m *schema.Migrator, args []string) error {
+	lg := loglib.GetLogger(ctx)
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		lg.InfoF("%d migrations applied, at migration %d", applied, m.Latest())
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		lg.InfoF("%d migrations reverted", reverted)
+	case "version":
+		version, dirty, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version %d, dirty %t, latest %d\n", version, dirty, m.Latest())
+	case "force":
+		if len(args) < 2 {
+			return fmt.Errorf("force needs a version")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err = m.Force(ctx, version); err != nil {
+			return err
+		}
+		lg.InfoF("version forced to %d", version)
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return nil
+}
+
+type envVar struct {
+	DBAddr string `env:"DATABASE_URL,secret"`
+}
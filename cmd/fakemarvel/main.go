@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/server"
+	"github.com/kagelui/marvel-forwarder/internal/service/marvel/fakemarvel"
+)
+
+func main() {
+	lg := loglib.DefaultLogger()
+
+	var (
+		addr       = flag.String("addr", ":8081", "address to listen on")
+		seed       = flag.Int64("seed", 1, "seed of the generated dataset and the fault injection")
+		count      = flag.Int("characters", 1493, "number of characters to generate")
+		dataset    = flag.String("dataset", "", "JSON file of characters to serve instead of generating them")
+		publicKey  = flag.String("public-key", os.Getenv("PUBLIC_KEY"), "public key expected in requests")
+		privateKey = flag.String("private-key", os.Getenv("PRIVATE_KEY"), "private key used to validate the request hash, validation is skipped if empty")
+		faults     fakemarvel.Faults
+	)
+	flag.DurationVar(&faults.Latency, "latency", 0, "latency added to every request")
+	flag.Float64Var(&faults.ErrorRate, "error-rate", 0, "probability of answering with a 500")
+	flag.Float64Var(&faults.ThrottleRate, "throttle-rate", 0, "probability of answering with a 429")
+	flag.Parse()
+
+	data := fakemarvel.GenerateDataset(*seed, *count)
+	if *dataset != "" {
+		f, err := os.Open(*dataset)
+		if err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(1)
+		}
+		data, err = fakemarvel.LoadDataset(f)
+		f.Close()
+		if err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(1)
+		}
+	}
+	if *privateKey == "" {
+		lg.WarnF("no private key given, request hashes will not be validated")
+	}
+
+	lg.InfoF("serving %d characters", data.Total())
+
+	app := server.New(server.Config{Addr: *addr, ShutdownTimeout: 5 * time.Second}, fakemarvel.NewServer(data, fakemarvel.Config{
+		PublicKey:  *publicKey,
+		PrivateKey: *privateKey,
+		Faults:     faults,
+		Seed:       *seed,
+	}))
+	if err := app.Start(); err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kagelui/marvel-forwarder/internal/models/apiclients"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+	service "github.com/kagelui/marvel-forwarder/internal/service/apiclients"
+)
+
+type clientAdmin interface {
+	Create(ctx context.Context, spec service.ClientSpec) (apiclients.Client, string, error)
+	List(ctx context.Context) ([]apiclients.Client, error)
+	Get(ctx context.Context, id int) (apiclients.Client, error)
+	Update(ctx context.Context, id int, spec service.ClientSpec) (apiclients.Client, error)
+	Rotate(ctx context.Context, id int) (apiclients.Client, string, error)
+	SetSuspended(ctx context.Context, id int, suspended bool) (apiclients.Client, error)
+	Delete(ctx context.Context, id int) error
+}
+
+// keyHeaders are the headers of the responses giving a plaintext key, which must not be stored on the way
+var keyHeaders = map[string]string{"Cache-Control": "no-store"}
+
+type clientRequest struct {
+	Name      *string  `json:"name"`
+	RateLimit *float64 `json:"rate_limit"`
+	Burst     *int     `json:"burst"`
+	Scopes    []string `json:"scopes"`
+}
+
+type clientResponse struct {
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	KeyPrefix    string     `json:"key_prefix"`
+	RateLimit    float64    `json:"rate_limit"`
+	Burst        int        `json:"burst"`
+	Scopes       []string   `json:"scopes"`
+	Suspended    bool       `json:"suspended"`
+	RequestCount int64      `json:"request_count"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	// Key is the plaintext key, only given when created or rotated
+	Key string `json:"key,omitempty"`
+}
+
+func toClientResponse(c apiclients.Client, key string) clientResponse {
+	scopes := []string(c.Scopes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return clientResponse{
+		ID:           c.ID,
+		Name:         c.Name,
+		KeyPrefix:    c.KeyPrefix,
+		RateLimit:    c.RateLimit,
+		Burst:        c.Burst,
+		Scopes:       scopes,
+		Suspended:    c.SuspendedAt != nil,
+		RequestCount: c.RequestCount,
+		LastUsedAt:   c.LastUsedAt,
+		CreatedAt:    c.CreatedAt,
+		Key:          key,
+	}
+}
+
+// RequireAdmin rejects requests without one of the admin tokens, given as a bearer token
+func RequireAdmin(tokens ...string) web.HandlerWrapper {
+	return func(next web.HandlerFunc) web.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") || !validAdminToken(strings.TrimPrefix(auth, "Bearer "), tokens) {
+				return &web.Error{
+					Status:  http.StatusUnauthorized,
+					Code:    "invalid_admin_token",
+					Desc:    "invalid admin token",
+					Headers: map[string]string{"WWW-Authenticate": "Bearer"},
+				}
+			}
+			return next(w, r)
+		}
+	}
+}
+
+// validAdminToken compares the given token with every token in constant time
+func validAdminToken(given string, tokens []string) bool {
+	valid := false
+	for _, token := range tokens {
+		if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// CreateAPIClient creates an API client, its key is in the response and nowhere else
+func CreateAPIClient(a clientAdmin) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+		spec, err := decodeClientRequest(r)
+		if err != nil {
+			return err
+		}
+
+		c, key, err := a.Create(ctx, spec)
+		if err != nil {
+			return toWebError(err, "API client creation error")
+		}
+		web.RespondJSONWithStatus(ctx, w, http.StatusCreated, toClientResponse(c, key), keyHeaders)
+		return nil
+	}
+}
+
+// ListAPIClients lists the API clients
+func ListAPIClients(a clientAdmin) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+		clients, err := a.List(ctx)
+		if err != nil {
+			return toWebError(err, "API client list error")
+		}
+
+		result := make([]clientResponse, len(clients))
+		for i, c := range clients {
+			result[i] = toClientResponse(c, "")
+		}
+		web.RespondJSON(ctx, w, result, nil)
+		return nil
+	}
+}
+
+// GetAPIClient returns an API client
+func GetAPIClient(a clientAdmin) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+		id, err := clientID(r)
+		if err != nil {
+			return err
+		}
+
+		c, err := a.Get(ctx, id)
+		if err != nil {
+			return toWebError(err, "API client error")
+		}
+		web.RespondJSON(ctx, w, toClientResponse(c, ""), nil)
+		return nil
+	}
+}
+
+// UpdateAPIClient sets the name, rate limit, burst and scopes of an API client
+func UpdateAPIClient(a clientAdmin) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+		id, err := clientID(r)
+		if err != nil {
+			return err
+		}
+		spec, err := decodeClientRequest(r)
+		if err != nil {
+			return err
+		}
+
+		c, err := a.Update(ctx, id, spec)
+		if err != nil {
+			return toWebError(err, "API client update error")
+		}
+		web.RespondJSON(ctx, w, toClientResponse(c, ""), nil)
+		return nil
+	}
+}
+
+// RotateAPIClientKey replaces the key of an API client, the new key is in the response and nowhere else
+func RotateAPIClientKey(a clientAdmin) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+		id, err := clientID(r)
+		if err != nil {
+			return err
+		}
+
+		c, key, err := a.Rotate(ctx, id)
+		if err != nil {
+			return toWebError(err, "API client rotation error")
+		}
+		web.RespondJSON(ctx, w, toClientResponse(c, key), keyHeaders)
+		return nil
+	}
+}
+
+// SuspendAPIClient suspends, or resumes, an API client
+func SuspendAPIClient(a clientAdmin, suspended bool) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+		id, err := clientID(r)
+		if err != nil {
+			return err
+		}
+
+		c, err := a.SetSuspended(ctx, id, suspended)
+		if err != nil {
+			return toWebError(err, "API client suspension error")
+		}
+		web.RespondJSON(ctx, w, toClientResponse(c, ""), nil)
+		return nil
+	}
+}
+
+// DeleteAPIClient deletes an API client
+func DeleteAPIClient(a clientAdmin) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		id, err := clientID(r)
+		if err != nil {
+			return err
+		}
+
+		if err = a.Delete(r.Context(), id); err != nil {
+			return toWebError(err, "API client deletion error")
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+func clientID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return 0, &web.Error{
+			Status: http.StatusBadRequest,
+			Code:   "malformed_id",
+			Desc:   "malformed ID",
+		}
+	}
+	return id, nil
+}
+
+func decodeClientRequest(r *http.Request) (service.ClientSpec, error) {
+	var req clientRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return service.ClientSpec{}, &web.Error{
+			Status: http.StatusBadRequest,
+			Code:   "malformed_body",
+			Desc:   "malformed body: " + err.Error(),
+		}
+	}
+	return service.ClientSpec{
+		Name:      req.Name,
+		RateLimit: req.RateLimit,
+		Burst:     req.Burst,
+		Scopes:    req.Scopes,
+	}, nil
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kagelui/marvel-forwarder/internal/models/apiclients"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name       string
+		tokens     []string
+		header     string
+		wantStatus int
+	}{
+		{name: "missing token", tokens: []string{"s3cret"}, wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", tokens: []string{"s3cret"}, header: "Bearer s3cre", wantStatus: http.StatusUnauthorized},
+		{name: "not a bearer token", tokens: []string{"s3cret"}, header: "Basic s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "bare token", tokens: []string{"s3cret"}, header: "s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "no admin token configured", header: "Bearer ", wantStatus: http.StatusUnauthorized},
+		{name: "empty admin token", tokens: []string{""}, header: "Bearer ", wantStatus: http.StatusUnauthorized},
+		{name: "good token", tokens: []string{"s3cret"}, header: "Bearer s3cret", wantStatus: http.StatusNoContent},
+		{name: "old token while rotating", tokens: []string{"n3w", "s3cret"}, header: "Bearer s3cret", wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := web.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+				w.WriteHeader(http.StatusNoContent)
+				return nil
+			}, RequireAdmin(tt.tokens...))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/clients", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			web.Handler{H: h}.ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+		})
+	}
+}
+
+func TestAdminHandlers(t *testing.T) {
+	created := time.Date(2020, 11, 8, 9, 0, 0, 0, time.UTC)
+	admin := mockAdmin{clients: map[int]apiclients.Client{
+		7: {ID: 7, Name: "analytics", KeyPrefix: "mf_0123abcd", RateLimit: 10, Burst: 20, Scopes: []string{"characters:read"}, CreatedAt: created},
+	}}
+	analytics := `"id":7,"name":"analytics","key_prefix":"mf_0123abcd","rate_limit":10,"burst":%s,"scopes":["characters:read"],"suspended":false,"request_count":0,"last_used_at":null,"created_at":"2020-11-08T09:00:00Z"`
+
+	r := mux.NewRouter()
+	r.Handle("/admin/clients", WrapError(CreateAPIClient(admin))).Methods("POST")
+	r.Handle("/admin/clients", WrapError(ListAPIClients(admin))).Methods("GET")
+	r.Handle("/admin/clients/{id}", WrapError(GetAPIClient(admin))).Methods("GET")
+	r.Handle("/admin/clients/{id}", WrapError(UpdateAPIClient(admin))).Methods("PATCH")
+	r.Handle("/admin/clients/{id}", WrapError(DeleteAPIClient(admin))).Methods("DELETE")
+	r.Handle("/admin/clients/{id}/rotate", WrapError(RotateAPIClientKey(admin))).Methods("POST")
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		wantStatus  int
+		wantBody    string
+		wantNoStore bool
+	}{
+		{
+			name:        "create",
+			method:      http.MethodPost,
+			path:        "/admin/clients",
+			body:        `{"name":"search"}`,
+			wantStatus:  http.StatusCreated,
+			wantBody:    `{"id":1,"name":"search","key_prefix":"mf_0123abcd","rate_limit":0,"burst":0,"scopes":[],"suspended":false,"request_count":0,"last_used_at":null,"created_at":"0001-01-01T00:00:00Z","key":"mf_0123abcdef"}`,
+			wantNoStore: true,
+		},
+		{
+			name:       "create with unknown field",
+			method:     http.MethodPost,
+			path:       "/admin/clients",
+			body:       `{"name":"search","rate":3}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"malformed_body","error_description":"malformed body: json: unknown field \"rate\""}`,
+		},
+		{
+			name:       "list",
+			method:     http.MethodGet,
+			path:       "/admin/clients",
+			wantStatus: http.StatusOK,
+			wantBody:   `[{` + strings.Replace(analytics, "%s", "20", 1) + `}]`,
+		},
+		{
+			name:       "get",
+			method:     http.MethodGet,
+			path:       "/admin/clients/7",
+			wantStatus: http.StatusOK,
+			wantBody:   `{` + strings.Replace(analytics, "%s", "20", 1) + `}`,
+		},
+		{
+			name:       "get malformed ID",
+			method:     http.MethodGet,
+			path:       "/admin/clients/x",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"malformed_id","error_description":"malformed ID"}`,
+		},
+		{
+			name:       "update",
+			method:     http.MethodPatch,
+			path:       "/admin/clients/7",
+			body:       `{"burst":5}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{` + strings.Replace(analytics, "%s", "5", 1) + `}`,
+		},
+		{
+			name:       "rename",
+			method:     http.MethodPatch,
+			path:       "/admin/clients/7",
+			body:       `{"name":"reporting"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{` + strings.Replace(strings.Replace(analytics, "%s", "20", 1), "analytics", "reporting", 1) + `}`,
+		},
+		{
+			name:        "rotate",
+			method:      http.MethodPost,
+			path:        "/admin/clients/7/rotate",
+			wantStatus:  http.StatusOK,
+			wantBody:    `{` + strings.Replace(analytics, "%s", "20", 1) + `,"key":"mf_fedcba98765"}`,
+			wantNoStore: true,
+		},
+		{
+			name:       "delete",
+			method:     http.MethodDelete,
+			path:       "/admin/clients/7",
+			wantStatus: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantBody, rr.Body.String())
+			testutil.Equals(t, tt.wantNoStore, rr.Header().Get("Cache-Control") == "no-store")
+		})
+	}
+}
+
+func TestAdminHandlers_notFound(t *testing.T) {
+	admin := mockAdmin{err: &web.Error{Status: http.StatusNotFound, Code: "no_such_client", Desc: "no such client"}}
+	r := mux.NewRouter()
+	r.Handle("/admin/clients/{id}", WrapError(GetAPIClient(admin))).Methods("GET")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/clients/3", nil))
+
+	testutil.Equals(t, http.StatusNotFound, rr.Code)
+	testutil.Equals(t, `{"error":"no_such_client","error_description":"no such client"}`, rr.Body.String())
+}
+
+func TestAdminHandlers_keyNotLogged(t *testing.T) {
+	admin := mockAdmin{clients: map[int]apiclients.Client{7: {ID: 7, Name: "analytics", KeyPrefix: "mf_0123abcd"}}}
+	r := mux.NewRouter()
+	r.Handle("/admin/clients", WrapError(CreateAPIClient(admin))).Methods("POST")
+	r.Handle("/admin/clients/{id}/rotate", WrapError(RotateAPIClientKey(admin))).Methods("POST")
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		wantKey string
+	}{
+		{name: "create", path: "/admin/clients", body: `{"name":"search"}`, wantKey: "mf_0123abcdef"},
+		{name: "rotate", path: "/admin/clients/7/rotate", wantKey: "mf_fedcba98765"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			base := logrus.New()
+			base.Out = &out
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req = req.WithContext(loglib.SetLogger(req.Context(), loglib.NewLogger(logrus.NewEntry(base))))
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			testutil.Asserts(t, strings.Contains(rr.Body.String(), tt.wantKey), "key missing from the response: %s", rr.Body.String())
+			testutil.Asserts(t, out.Len() > 0, "nothing logged")
+			testutil.Asserts(t, !strings.Contains(out.String(), tt.wantKey), "key logged: %s", out.String())
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/apiclients"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+	service "github.com/kagelui/marvel-forwarder/internal/service/apiclients"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	apiKeyParam  = "api_key"
+)
+
+type clientAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (apiclients.Client, error)
+	Allow(c apiclients.Client) error
+}
+
+// RequireAPIKey rejects requests without a valid API key, given in the X-API-Key header or
+// the api_key query parameter, requests of clients without the scope and requests over
+// the rate limit of the client. The responses vary by X-API-Key, and are not to be stored
+// at all when the key is in the query
+func RequireAPIKey(a clientAuthenticator, scope string) web.HandlerWrapper {
+	return func(next web.HandlerFunc) web.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			w.Header().Add("Vary", apiKeyHeader)
+			key := strings.TrimSpace(r.Header.Get(apiKeyHeader))
+			if key == "" {
+				key = r.URL.Query().Get(apiKeyParam)
+				// the key is part of the URL, which no cache should keep
+				if key != "" {
+					w.Header().Set("Cache-Control", "no-store")
+				}
+			}
+			if key == "" {
+				return &web.Error{
+					Status:  http.StatusUnauthorized,
+					Code:    "missing_api_key",
+					Desc:    "missing API key",
+					Headers: map[string]string{"WWW-Authenticate": apiKeyHeader},
+				}
+			}
+
+			c, err := a.Authenticate(r.Context(), key)
+			if err != nil {
+				return toWebError(err, "API key authentication error")
+			}
+			if !c.HasScope(scope) {
+				return &web.Error{
+					Status: http.StatusForbidden,
+					Code:   "insufficient_scope",
+					Desc:   fmt.Sprintf("API key lacks the %s scope", scope),
+				}
+			}
+			if err = a.Allow(c); err != nil {
+				return err
+			}
+
+			return next(w, r.WithContext(service.WithClient(r.Context(), c)))
+		}
+	}
+}
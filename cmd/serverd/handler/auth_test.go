@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/apiclients"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+	service "github.com/kagelui/marvel-forwarder/internal/service/apiclients"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	analytics := apiclients.Client{ID: 7, Name: "analytics", Scopes: []string{"characters:read"}}
+	authenticator := mockAuthenticator{
+		authenticateFn: func(ctx context.Context, key string) (apiclients.Client, error) {
+			switch key {
+			case "mf_good", "mf_busy":
+				return analytics, nil
+			case "mf_unscoped":
+				return apiclients.Client{ID: 8, Name: "search"}, nil
+			case "mf_wonky":
+				return apiclients.Client{}, fmt.Errorf("db down")
+			}
+			return apiclients.Client{}, &web.Error{Status: http.StatusUnauthorized, Code: "invalid_api_key", Desc: "invalid API key"}
+		},
+	}
+
+	tests := []struct {
+		name           string
+		header         string
+		query          string
+		allowErr       error
+		wantStatus     int
+		wantBody       string
+		wantRetryAfter string
+		wantNoStore    bool
+	}{
+		{
+			name:       "missing key",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"error":"missing_api_key","error_description":"missing API key"}`,
+		},
+		{
+			name:       "bad key",
+			header:     "mf_bad",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"error":"invalid_api_key","error_description":"invalid API key"}`,
+		},
+		{
+			name:       "missing scope",
+			header:     "mf_unscoped",
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"error":"insufficient_scope","error_description":"API key lacks the characters:read scope"}`,
+		},
+		{
+			name:       "lookup error",
+			header:     "mf_wonky",
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"internal_error","error_description":"Sorry, there was a problem. Please try again later."}`,
+		},
+		{
+			name:           "over the limit",
+			query:          "mf_busy",
+			allowErr:       &web.Error{Status: http.StatusTooManyRequests, Code: "rate_limited", Desc: "too many requests", Headers: map[string]string{"Retry-After": "2"}},
+			wantStatus:     http.StatusTooManyRequests,
+			wantBody:       `{"error":"rate_limited","error_description":"too many requests"}`,
+			wantRetryAfter: "2",
+			wantNoStore:    true,
+		},
+		{
+			name:       "good key in header",
+			header:     "mf_good",
+			wantStatus: http.StatusOK,
+			wantBody:   `"analytics"`,
+		},
+		{
+			name:        "good key in query",
+			query:       "mf_good",
+			wantStatus:  http.StatusOK,
+			wantBody:    `"analytics"`,
+			wantNoStore: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := authenticator
+			a.allowErr = tt.allowErr
+			h := web.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+				c, _ := service.ClientFromContext(r.Context())
+				web.RespondJSON(r.Context(), w, c.Name, nil)
+				return nil
+			}, RequireAPIKey(a, "characters:read"))
+
+			req := httptest.NewRequest(http.MethodGet, "/characters?api_key="+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			web.Handler{H: h}.ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantBody, rr.Body.String())
+			testutil.Equals(t, tt.wantRetryAfter, rr.Header().Get("Retry-After"))
+			testutil.Equals(t, "X-API-Key", rr.Header().Get("Vary"))
+			testutil.Equals(t, tt.wantNoStore, rr.Header().Get("Cache-Control") == "no-store")
+		})
+	}
+}
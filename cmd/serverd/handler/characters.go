@@ -2,8 +2,10 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/kagelui/marvel-forwarder/internal/models/characters"
@@ -12,22 +14,116 @@ import (
 
 type characterStore interface {
 	GetCharacterIDs(ctx context.Context) ([]int, error)
+	GetCharacters(ctx context.Context, fields ...characters.Field) ([]characters.Character, error)
 	GetCharacter(ctx context.Context, id int) (characters.Character, error)
 }
 
-// GetMarvelCharacterList returns a list of marvel characters' ID
+// characterView is a character with only some of its fields, the others being left out of the JSON.
+// The names are those of characters.Character, as returned by GetMarvelCharacterDetail
+type characterView struct {
+	ID          *int    `json:"ID,omitempty"`
+	Name        *string `json:"Name,omitempty"`
+	Description *string `json:"Description,omitempty"`
+}
+
+func newCharacterView(ch characters.Character, fields []characters.Field) characterView {
+	var v characterView
+	for _, f := range fields {
+		switch f {
+		case characters.FieldID:
+			v.ID = &ch.ID
+		case characters.FieldName:
+			v.Name = &ch.Name
+		case characters.FieldDescription:
+			v.Description = &ch.Description
+		}
+	}
+	return v
+}
+
+// GetMarvelCharacterList returns a list of marvel characters' ID, or of the characters themselves
+// with ?expand=true, or with only some of their fields with e.g. ?fields=id,name
 func GetMarvelCharacterList(s characterStore) web.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) error {
 		ctx := r.Context()
-		ids, err := s.GetCharacterIDs(ctx)
+
+		fields, err := listFields(r)
+		if err != nil {
+			return err
+		}
+		if fields == nil {
+			ids, err := s.GetCharacterIDs(ctx)
+			if err != nil {
+				return web.NewError(err, "character ID list error")
+			}
+			web.RespondJSON(ctx, w, ids, nil)
+			return nil
+		}
+
+		chs, err := s.GetCharacters(ctx, fields...)
 		if err != nil {
-			return web.NewError(err, "character ID list error")
+			return web.NewError(err, "character list error")
 		}
-		web.RespondJSON(ctx, w, ids, nil)
+		views := make([]characterView, len(chs))
+		for i, ch := range chs {
+			views[i] = newCharacterView(ch, fields)
+		}
+		web.RespondJSON(ctx, w, views, nil)
 		return nil
 	}
 }
 
+// listFields returns the fields asked for by ?fields, in the order of characters.Fields, or all of them
+// with ?expand=true, nil for the IDs only
+func listFields(r *http.Request) ([]characters.Field, error) {
+	q := r.URL.Query()
+
+	var invalid []web.FieldError
+	expand := false
+	if v := q.Get("expand"); v != "" {
+		var err error
+		if expand, err = strconv.ParseBool(v); err != nil {
+			invalid = append(invalid, web.FieldError{Name: "expand", Reason: "must be true or false"})
+		}
+	}
+
+	var fields []characters.Field
+	if v := q.Get("fields"); v != "" {
+		asked := make(map[characters.Field]bool)
+		for _, name := range strings.Split(v, ",") {
+			f := characters.Field(strings.ToLower(strings.TrimSpace(name)))
+			if !containsField(characters.Fields, f) {
+				invalid = append(invalid, web.FieldError{Name: "fields", Reason: fmt.Sprintf("unknown field %q, must be among id, name, description", name)})
+				continue
+			}
+			asked[f] = true
+		}
+		// in a fixed order, so that the same fields share the cache whatever their order
+		for _, f := range characters.Fields {
+			if asked[f] {
+				fields = append(fields, f)
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, web.NewValidationError(invalid...)
+	}
+
+	if fields == nil && expand {
+		fields = characters.Fields
+	}
+	return fields, nil
+}
+
+func containsField(fields []characters.Field, f characters.Field) bool {
+	for _, field := range fields {
+		if field == f {
+			return true
+		}
+	}
+	return false
+}
+
 // GetMarvelCharacterDetail returns a marvel characters' detail
 func GetMarvelCharacterDetail(s characterStore) web.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) error {
@@ -46,7 +142,7 @@ func GetMarvelCharacterDetail(s characterStore) web.HandlerFunc {
 
 		info, err := s.GetCharacter(ctx, id)
 		if err != nil {
-			return web.NewError(err, "no such character")
+			return toWebError(err, "character error")
 		}
 		web.RespondJSON(ctx, w, info, nil)
 		return nil
@@ -17,9 +17,21 @@ func TestGetMarvelCharacterList(t *testing.T) {
 	type args struct {
 		s characterStore
 	}
+	// projects the characters the way the repositories do
+	projecting := mockStore{getCharactersFn: func(ctx context.Context, fields ...characters.Field) ([]characters.Character, error) {
+		chs := []characters.Character{
+			{ID: 391264, Name: "Daredevil", Description: "some broke lawyer"},
+			{ID: 831256, Name: "Stick", Description: ""},
+		}
+		for i, ch := range chs {
+			chs[i] = ch.Project(fields...)
+		}
+		return chs, nil
+	}}
 	tests := []struct {
 		name         string
 		args         args
+		target       string
 		expectedCode int
 		expectedBody string
 	}{
@@ -43,10 +55,62 @@ func TestGetMarvelCharacterList(t *testing.T) {
 			expectedCode: http.StatusOK,
 			expectedBody: `[391264,831256]`,
 		},
+		{
+			name: "not expanded",
+			args: args{s: mockStore{
+				getCharacterIDsFn: func(ctx context.Context) ([]int, error) {
+					return []int{391264}, nil
+				},
+			}},
+			target:       "/characters?expand=false",
+			expectedCode: http.StatusOK,
+			expectedBody: `[391264]`,
+		},
+		{
+			name:         "expanded",
+			args:         args{s: projecting},
+			target:       "/characters?expand=true",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"ID":391264,"Name":"Daredevil","Description":"some broke lawyer"},{"ID":831256,"Name":"Stick","Description":""}]`,
+		},
+		{
+			name:         "some fields",
+			args:         args{s: projecting},
+			target:       "/characters?fields=name,%20ID,name",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"ID":391264,"Name":"Daredevil"},{"ID":831256,"Name":"Stick"}]`,
+		},
+		{
+			name:         "fields over expand",
+			args:         args{s: projecting},
+			target:       "/characters?expand=true&fields=description",
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"Description":"some broke lawyer"},{"Description":""}]`,
+		},
+		{
+			name:         "invalid params",
+			args:         args{s: projecting},
+			target:       "/characters?expand=maybe&fields=id,comics",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"invalid_params","error_description":"invalid parameters, expand: must be true or false; fields: unknown field \"comics\", must be among id, name, description","invalid_params":[{"name":"expand","reason":"must be true or false"},{"name":"fields","reason":"unknown field \"comics\", must be among id, name, description"}]}`,
+		},
+		{
+			name: "naughty store expanded",
+			args: args{s: mockStore{getCharactersFn: func(ctx context.Context, fields ...characters.Field) ([]characters.Character, error) {
+				return nil, fmt.Errorf("mock error")
+			}}},
+			target:       "/characters?expand=true",
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: `{"error":"internal_error","error_description":"Sorry, there was a problem. Please try again later."}`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			target := tt.target
+			if target == "" {
+				target = "/"
+			}
+			req := httptest.NewRequest(http.MethodGet, target, nil)
 			rr := httptest.NewRecorder()
 			web.Handler{H: GetMarvelCharacterList(tt.args.s)}.ServeHTTP(rr, req)
 			testutil.Equals(t, tt.expectedCode, rr.Code)
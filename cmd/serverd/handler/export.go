@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/characters"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+)
+
+type characterExporter interface {
+	EachCharacter(ctx context.Context, fn func(characters.Character) error) error
+}
+
+// exportedCharacter is a row of the export of the characters
+type exportedCharacter struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// exportHeader is the CSV header of exportedCharacter
+var exportHeader = []string{"id", "name", "description"}
+
+func (c exportedCharacter) CSVRecord() []string {
+	return []string{strconv.Itoa(c.ID), c.Name, c.Description}
+}
+
+// ExportCharacters streams every marvel character as NDJSON or CSV, see web.NegotiateStreamFormat.
+// The export is stopped after timeout, if positive, which is meant to be below the write timeout of
+// the server so that running out of time is told apart from other errors rather than cut off silently
+func ExportCharacters(s characterExporter, timeout time.Duration) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+
+		format, err := web.NegotiateStreamFormat(r)
+		if err != nil {
+			return err
+		}
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		stream := web.NewStream(w, r, format, exportHeader)
+		err = s.EachCharacter(ctx, func(ch characters.Character) error {
+			return stream.Write(exportedCharacter{ID: ch.ID, Name: ch.Name, Description: ch.Description})
+		})
+		if err == nil {
+			err = stream.Close()
+		}
+		if err == nil {
+			return nil
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && r.Context().Err() == nil {
+			err = fmt.Errorf("export took longer than %s: %w", timeout, err)
+			if !stream.Started() {
+				return &web.Error{
+					Status: http.StatusServiceUnavailable,
+					Code:   "export_timeout",
+					Desc:   "the export took too long, please try again later",
+					Err:    err,
+				}
+			}
+		}
+		if !stream.Started() {
+			return web.NewError(err, "character export error")
+		}
+
+		// the status is sent already, the client can only tell by the response being cut short
+		loglib.GetLogger(ctx).ErrorF("[Export] aborted after the response started: %s", err)
+		panic(http.ErrAbortHandler)
+	}
+}
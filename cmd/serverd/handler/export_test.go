@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/characters"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestExportCharacters(t *testing.T) {
+	each := func(chs ...characters.Character) func(context.Context, func(characters.Character) error) error {
+		return func(ctx context.Context, fn func(characters.Character) error) error {
+			for _, ch := range chs {
+				if err := fn(ch); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	daredevil := characters.Character{ID: 832654, Name: "Daredevil", Description: "some broke lawyer"}
+	kingpin := characters.Character{ID: 1082344, Name: "Kingpin", Description: "some bulky, rich villain"}
+
+	tests := []struct {
+		name         string
+		s            characterExporter
+		target       string
+		accept       string
+		expectedCode int
+		expectedType string
+		expectedBody string
+	}{
+		{
+			name:         "ndjson",
+			s:            mockStore{eachCharacterFn: each(daredevil, kingpin)},
+			target:       "/export/characters",
+			expectedCode: http.StatusOK,
+			expectedType: "application/x-ndjson",
+			expectedBody: `{"id":832654,"name":"Daredevil","description":"some broke lawyer"}
+{"id":1082344,"name":"Kingpin","description":"some bulky, rich villain"}
+`,
+		},
+		{
+			name:         "csv by accept",
+			s:            mockStore{eachCharacterFn: each(daredevil, kingpin)},
+			target:       "/export/characters",
+			accept:       "text/csv",
+			expectedCode: http.StatusOK,
+			expectedType: "text/csv; charset=utf-8",
+			expectedBody: `id,name,description
+832654,Daredevil,some broke lawyer
+1082344,Kingpin,"some bulky, rich villain"
+`,
+		},
+		{
+			name:         "csv by format",
+			s:            mockStore{},
+			target:       "/export/characters?format=csv",
+			accept:       "application/x-ndjson",
+			expectedCode: http.StatusOK,
+			expectedType: "text/csv; charset=utf-8",
+			expectedBody: "id,name,description\n",
+		},
+		{
+			name:         "not acceptable",
+			s:            mockStore{},
+			target:       "/export/characters",
+			accept:       "application/json",
+			expectedCode: http.StatusNotAcceptable,
+			expectedType: "application/json",
+			expectedBody: `{"error":"not_acceptable","error_description":"only application/x-ndjson and text/csv can be served"}`,
+		},
+		{
+			name: "wonky store",
+			s: mockStore{eachCharacterFn: func(ctx context.Context, fn func(characters.Character) error) error {
+				return fmt.Errorf("mock error")
+			}},
+			target:       "/export/characters",
+			expectedCode: http.StatusInternalServerError,
+			expectedType: "application/json",
+			expectedBody: `{"error":"internal_error","error_description":"Sorry, there was a problem. Please try again later."}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			web.Handler{H: ExportCharacters(tt.s, 0)}.ServeHTTP(rr, req)
+			testutil.Equals(t, tt.expectedCode, rr.Code)
+			testutil.Equals(t, tt.expectedType, rr.Header().Get("Content-Type"))
+			testutil.Equals(t, tt.expectedBody, rr.Body.String())
+		})
+	}
+}
+
+func TestExportCharacters_abort(t *testing.T) {
+	s := mockStore{eachCharacterFn: func(ctx context.Context, fn func(characters.Character) error) error {
+		if err := fn(characters.Character{ID: 1}); err != nil {
+			return err
+		}
+		return fmt.Errorf("connection reset")
+	}}
+
+	// the response cannot be turned into an error once started, so it is aborted
+	defer func() {
+		testutil.Asserts(t, recover() == http.ErrAbortHandler, "the handler should be aborted")
+	}()
+	rr := httptest.NewRecorder()
+	_ = ExportCharacters(s, 0)(rr, httptest.NewRequest(http.MethodGet, "/export/characters", nil))
+	t.Error("the handler should not return")
+}
+
+func TestExportCharacters_timeout(t *testing.T) {
+	s := mockStore{eachCharacterFn: func(ctx context.Context, fn func(characters.Character) error) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	rr := httptest.NewRecorder()
+	web.Handler{H: ExportCharacters(s, time.Millisecond)}.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/export/characters", nil))
+	testutil.Equals(t, http.StatusServiceUnavailable, rr.Code)
+	testutil.Equals(t, `{"error":"export_timeout","error_description":"the export took too long, please try again later"}`, rr.Body.String())
+}
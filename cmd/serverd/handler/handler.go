@@ -3,13 +3,14 @@ package handler
 import (
 	"net/http"
 
+	"github.com/gorilla/mux"
 	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
 )
 
 // WrapError wraps the web.HandlerFunc to standard http.HandlerFunc with error handling
 func WrapError(h web.HandlerFunc) http.HandlerFunc {
-	// wraps error reporter
-	h = web.Wrap(h, web.ReportErrorWrapper())
+	// wraps error reporter, and panic recovery which reports on its own
+	h = web.Wrap(h, web.ReportErrorWrapper(), web.RecoverWrapper())
 
 	// Web handler
 	wh := web.Handler{H: h}
@@ -17,3 +18,25 @@ func WrapError(h web.HandlerFunc) http.HandlerFunc {
 	return wh.ServeHTTP
 }
 
+// toWebError returns err as is should it be an *web.Error, else a 500 Error with the message
+func toWebError(err error, message string) error {
+	if webErr := web.TypecastError(err); webErr != nil {
+		return webErr
+	}
+	return web.NewError(err, message)
+}
+
+// RouteTemplate returns a func giving the template of the route of router matched by a request, if any
+func RouteTemplate(router *mux.Router) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		var match mux.RouteMatch
+		if !router.Match(r, &match) || match.Route == nil {
+			return ""
+		}
+		tpl, err := match.Route.GetPathTemplate()
+		if err != nil {
+			return ""
+		}
+		return tpl
+	}
+}
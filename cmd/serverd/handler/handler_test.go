@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/gorilla/mux"
 	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
 	"github.com/kagelui/marvel-forwarder/internal/testutil"
 )
@@ -29,6 +30,15 @@ func TestWrapError(t *testing.T) {
 			wantBody:   `{"error":"code","error_description":"desc"}`,
 			wantHeader: "application/json",
 		},
+		{
+			name: "panic",
+			args: args{h: func(w http.ResponseWriter, r *http.Request) error {
+				panic("boom")
+			}},
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"internal_error","error_description":"Sorry, there was a problem. Please try again later."}`,
+			wantHeader: "application/json",
+		},
 		{
 			name: "no error",
 			args: args{h: func(w http.ResponseWriter, r *http.Request) error {
@@ -44,7 +54,7 @@ func TestWrapError(t *testing.T) {
 			rr := httptest.NewRecorder()
 			req := httptest.NewRequest(http.MethodGet, "/some/url", nil)
 
-			web.Handler{H: tt.args.h}.ServeHTTP(rr, req)
+			WrapError(tt.args.h).ServeHTTP(rr, req)
 
 			testutil.Equals(t, tt.wantStatus, rr.Code)
 			testutil.Equals(t, tt.wantBody, rr.Body.String())
@@ -52,3 +62,13 @@ func TestWrapError(t *testing.T) {
 		})
 	}
 }
+
+func TestRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.Handle("/characters/{id:[0-9]+}", http.NotFoundHandler()).Methods("GET")
+	route := RouteTemplate(r)
+
+	testutil.Equals(t, "/characters/{id:[0-9]+}", route(httptest.NewRequest(http.MethodGet, "/characters/1009610", nil)))
+	testutil.Equals(t, "", route(httptest.NewRequest(http.MethodGet, "/comics", nil)))
+	testutil.Equals(t, "", route(httptest.NewRequest(http.MethodPost, "/characters/1009610", nil)))
+}
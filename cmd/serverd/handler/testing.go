@@ -3,12 +3,16 @@ package handler
 import (
 	"context"
 
+	"github.com/kagelui/marvel-forwarder/internal/models/apiclients"
 	"github.com/kagelui/marvel-forwarder/internal/models/characters"
+	service "github.com/kagelui/marvel-forwarder/internal/service/apiclients"
 )
 
 type mockStore struct {
 	getCharacterIDsFn    func(context.Context) ([]int, error)
+	getCharactersFn      func(ctx context.Context, fields ...characters.Field) ([]characters.Character, error)
 	getCharacterDetailFn func(ctx context.Context, id int) (characters.Character, error)
+	eachCharacterFn      func(ctx context.Context, fn func(characters.Character) error) error
 }
 
 func (s mockStore) GetCharacterIDs(ctx context.Context) ([]int, error) {
@@ -18,9 +22,91 @@ func (s mockStore) GetCharacterIDs(ctx context.Context) ([]int, error) {
 	return nil, nil
 }
 
+func (s mockStore) GetCharacters(ctx context.Context, fields ...characters.Field) ([]characters.Character, error) {
+	if s.getCharactersFn != nil {
+		return s.getCharactersFn(ctx, fields...)
+	}
+	return nil, nil
+}
+
 func (s mockStore) GetCharacter(ctx context.Context, id int) (characters.Character, error) {
 	if s.getCharacterDetailFn != nil {
 		return s.getCharacterDetailFn(ctx, id)
 	}
 	return characters.Character{}, nil
 }
+
+func (s mockStore) EachCharacter(ctx context.Context, fn func(characters.Character) error) error {
+	if s.eachCharacterFn != nil {
+		return s.eachCharacterFn(ctx, fn)
+	}
+	return nil
+}
+
+type mockAuthenticator struct {
+	authenticateFn func(ctx context.Context, key string) (apiclients.Client, error)
+	allowErr       error
+}
+
+func (a mockAuthenticator) Authenticate(ctx context.Context, key string) (apiclients.Client, error) {
+	return a.authenticateFn(ctx, key)
+}
+
+func (a mockAuthenticator) Allow(c apiclients.Client) error {
+	return a.allowErr
+}
+
+type mockAdmin struct {
+	clients map[int]apiclients.Client
+	err     error
+}
+
+func (a mockAdmin) Create(ctx context.Context, spec service.ClientSpec) (apiclients.Client, string, error) {
+	if a.err != nil {
+		return apiclients.Client{}, "", a.err
+	}
+	var name string
+	if spec.Name != nil {
+		name = *spec.Name
+	}
+	return apiclients.Client{ID: 1, Name: name, KeyPrefix: "mf_0123abcd", Scopes: spec.Scopes}, "mf_0123abcdef", nil
+}
+
+func (a mockAdmin) List(ctx context.Context) ([]apiclients.Client, error) {
+	var clients []apiclients.Client
+	for _, c := range a.clients {
+		clients = append(clients, c)
+	}
+	return clients, a.err
+}
+
+func (a mockAdmin) Get(ctx context.Context, id int) (apiclients.Client, error) {
+	if a.err != nil {
+		return apiclients.Client{}, a.err
+	}
+	return a.clients[id], nil
+}
+
+func (a mockAdmin) Update(ctx context.Context, id int, spec service.ClientSpec) (apiclients.Client, error) {
+	c, err := a.Get(ctx, id)
+	if spec.Name != nil {
+		c.Name = *spec.Name
+	}
+	if spec.Burst != nil {
+		c.Burst = *spec.Burst
+	}
+	return c, err
+}
+
+func (a mockAdmin) Rotate(ctx context.Context, id int) (apiclients.Client, string, error) {
+	c, err := a.Get(ctx, id)
+	return c, "mf_fedcba98765", err
+}
+
+func (a mockAdmin) SetSuspended(ctx context.Context, id int, suspended bool) (apiclients.Client, error) {
+	return a.Get(ctx, id)
+}
+
+func (a mockAdmin) Delete(ctx context.Context, id int) error {
+	return a.err
+}
@@ -1,43 +1,383 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	"github.com/kagelui/marvel-forwarder/cmd/serverd/handler"
+	"github.com/kagelui/marvel-forwarder/data/migrations"
+	models "github.com/kagelui/marvel-forwarder/internal/models/characters"
+	"github.com/kagelui/marvel-forwarder/internal/models/schema"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/database"
 	"github.com/kagelui/marvel-forwarder/internal/pkg/envvar"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/health"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/metrics"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/ops"
 	"github.com/kagelui/marvel-forwarder/internal/pkg/server"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+	"github.com/kagelui/marvel-forwarder/internal/service/apiclients"
 	"github.com/kagelui/marvel-forwarder/internal/service/characters"
+	"github.com/kagelui/marvel-forwarder/internal/service/marvel"
 	_ "github.com/lib/pq"
 )
 
 func main() {
+	os.Exit(run())
+}
+
+// run runs serverd until it is stopped, returning the exit code once the deferred calls are done
+func run() int {
+	migrate := flag.Bool("migrate", false, "run the pending migrations, instead of refusing to start should there be any")
+	envFile := flag.String("env-file", "", "a .env file of defaults for the env vars, which take precedence over it")
+	flag.Parse()
+
 	log.Println("server started")
 
+	src, err := envvar.WithDotenv(*envFile)
+	if err != nil {
+		log.Println(err.Error())
+		return 1
+	}
+
 	var e envVar
 
-	if err := envvar.Read(&e); err != nil {
+	if err := envvar.ReadFrom(src, &e); err != nil {
 		log.Println(err.Error())
-		os.Exit(1)
+		return 1
 	}
+	if err := e.check(); err != nil {
+		log.Println(err.Error())
+		return 1
+	}
+	log.Printf("config:\n%s", envvar.Format(&e))
+
+	checker := &health.Checker{}
+
+	// db is only set with the postgres storage
+	var db *sqlx.DB
+	var repo models.Repository
+	switch e.Storage {
+	case storagePostgres:
+		db, err = database.Connect(e.DBAddr, e.Pool)
+		if err != nil {
+			log.Println(err.Error())
+			return 132
+		}
 
-	db, err := sqlx.Connect("postgres", e.DBAddr)
+		migrator, err := schema.NewMigrator(db, migrations.FS)
+		if err == nil {
+			err = migrator.Ensure(context.Background(), *migrate)
+		}
+		if err != nil {
+			log.Println(err.Error())
+			return 133
+		}
+		checker.Add("db", health.Ping(db))
+		checker.Add("migrations", migrator.Check)
+		router, err := replicaRouter(db, e)
+		if err != nil {
+			log.Println(err.Error())
+			return 132
+		}
+		repo = &models.Postgres{DB: db, Router: router}
+	case storageFile:
+		if repo, err = models.OpenFile(e.StorageFile); err != nil {
+			log.Println(err.Error())
+			return 1
+		}
+		log.Printf("characters kept in %s", e.StorageFile)
+	case storageMemory:
+		repo = models.NewMemory()
+		log.Println("characters kept in memory")
+	}
+
+	closeReporters, err := registerReporters(e)
 	if err != nil {
 		log.Println(err.Error())
-		os.Exit(132)
+		return 1
+	}
+	defer closeReporters()
+
+	var store characters.Reader = &characters.ModelStore{Repo: repo}
+
+	if e.ReadThrough {
+		var m marvelEnvVar
+		if err := envvar.ReadFrom(src, &m); err != nil {
+			log.Println(err.Error())
+			return 1
+		}
+		log.Printf("marvel config:\n%s", envvar.Format(&m))
+		client := marvel.ApiClient{
+			Client:        &http.Client{Timeout: m.Timeout},
+			PublicKey:     m.PublicKey,
+			PrivateKey:    m.PrivateKey,
+			APIAddr:       m.APIAddr,
+			Retries:       marvelRetries,
+			RetryInterval: marvelRetryInterval,
+		}
+		store = characters.NewReadThroughStore(store, repo, client, m.NegativeTTL)
+		log.Println("read through to marvel enabled")
 	}
 
-	modelStore := &characters.ModelStore{DB: db}
+	if e.CacheTTL > 0 {
+		cache := characters.NewCachedStore(store, e.CacheTTL, e.CacheMaxEntries)
+		// the other storages are not synced by bifrost
+		if db != nil {
+			// a replica may be up to MaxLag behind when checked, and fall further behind until the next check
+			var replicaLag time.Duration
+			if len(e.DBReplicaAddrs) > 0 {
+				replicaLag = e.Replicas.MaxLag + e.Replicas.CheckInterval
+			}
+			go func() {
+				if err := cache.ListenForSyncs(context.Background(), e.DBAddr, replicaLag); err != nil {
+					log.Printf("cache invalidation disabled: %s", err)
+				}
+			}()
+		}
+		store = cache
+	}
+
+	var wrappers []web.HandlerWrapper
+	admin := &apiclients.Admin{DB: db}
+	if e.APIKeyAuth {
+		authenticator := apiclients.NewAuthenticator(db)
+		// the flusher writes out what is left once the server is done with its requests
+		flushCtx, stopFlusher := context.WithCancel(context.Background())
+		flushed := make(chan struct{})
+		go func() {
+			defer close(flushed)
+			authenticator.RunUsageFlusher(flushCtx, usageFlushInterval)
+		}()
+		defer func() {
+			stopFlusher()
+			<-flushed
+		}()
+		wrappers = append(wrappers, handler.RequireAPIKey(authenticator, apiclients.ScopeCharactersRead))
+		admin.Changed = authenticator.Forget
+		log.Println("API key authentication enabled")
+	}
 
 	r := mux.NewRouter()
-	r.Handle("/characters", handler.WrapError(handler.GetMarvelCharacterList(modelStore))).Methods("GET")
-	r.Handle("/characters/{id:[0-9]+}", handler.WrapError(handler.GetMarvelCharacterDetail(modelStore))).Methods("GET")
+	// the export is streamed from the repository, past the cache and the middlewares holding the body back.
+	// It stops a little before the write timeout, which would cut it off without a word
+	exportTimeout := e.Server.WriteTimeout * 9 / 10
+	r.Handle("/export/characters", handler.WrapError(web.Wrap(handler.ExportCharacters(&characters.ModelStore{Repo: repo}, exportTimeout), wrappers...))).Methods("GET")
+
+	// the last sync is when the characters last changed, unless the read through adds some in between
+	lastModified := store.LastSynced
+	if e.ReadThrough {
+		lastModified = nil
+	}
+	api := r.NewRoute().Subrouter()
+	api.Use(web.Compress(web.CompressionOptions{MinSize: e.CompressionMinSize}))
+	api.Use(web.Conditional(web.CachingOptions{
+		CacheControl: e.CacheControl,
+		LastModified: lastModified,
+		Private:      e.APIKeyAuth,
+	}))
+	api.Handle("/characters", handler.WrapError(web.Wrap(handler.GetMarvelCharacterList(store), wrappers...))).Methods("GET")
+	api.Handle("/characters/{id:[0-9]+}", handler.WrapError(web.Wrap(handler.GetMarvelCharacterDetail(store), wrappers...))).Methods("GET")
+
+	// the admin API is served on the ops port only
+	ar := mux.NewRouter()
+	if len(e.AdminTokens) > 0 {
+		requireAdmin := handler.RequireAdmin(e.AdminTokens...)
+		adminRoute := func(path string, h web.HandlerFunc, method string) {
+			ar.Handle(path, handler.WrapError(web.Wrap(h, requireAdmin))).Methods(method)
+		}
+		adminRoute("/admin/clients", handler.CreateAPIClient(admin), "POST")
+		adminRoute("/admin/clients", handler.ListAPIClients(admin), "GET")
+		adminRoute("/admin/clients/{id:[0-9]+}", handler.GetAPIClient(admin), "GET")
+		adminRoute("/admin/clients/{id:[0-9]+}", handler.UpdateAPIClient(admin), "PATCH")
+		adminRoute("/admin/clients/{id:[0-9]+}", handler.DeleteAPIClient(admin), "DELETE")
+		adminRoute("/admin/clients/{id:[0-9]+}/rotate", handler.RotateAPIClientKey(admin), "POST")
+		adminRoute("/admin/clients/{id:[0-9]+}/suspend", handler.SuspendAPIClient(admin, true), "POST")
+		adminRoute("/admin/clients/{id:[0-9]+}/resume", handler.SuspendAPIClient(admin, false), "POST")
+		log.Println("admin API enabled")
+	}
+
+	observe := func(router *mux.Router) http.Handler {
+		route := handler.RouteTemplate(router)
+		accessLog := web.AccessLog(web.AccessLogOptions{Route: route})
+		instrument := web.Instrument(web.InstrumentOptions{Route: route})
+		return accessLog(instrument(router))
+	}
+
+	if e.ReadyMaxSyncAge > 0 {
+		checker.Add("sync", characters.SyncedWithin(&characters.ModelStore{Repo: repo}, e.ReadyMaxSyncAge))
+	}
+
+	// the probes and metrics are kept off the public port, on a port the load balancers and
+	// Prometheus reach, while pprof and the admin API are on the ops port, only the admin API
+	// being logged and counted
+	probeMux := http.NewServeMux()
+	probeMux.Handle("/metrics", metrics.Handler())
+	probeMux.Handle("/healthz", health.Liveness())
+	probeMux.Handle("/readyz", checker.Readiness())
 
-	server.New(":8080", r).Start()
+	opsMux := ops.Mux()
+	opsMux.Handle("/admin/", observe(ar))
+
+	app := server.New(e.Server, observe(r))
+	app.Listen(e.ProbeAddr, probeMux)
+	app.Listen(e.OpsAddr, opsMux)
+	app.OnDrain(checker.Drain)
+	if err := app.Start(); err != nil {
+		log.Println(err.Error())
+		return 1
+	}
+	return 0
+}
+
+// registerReporters registers the error reporters enabled by e, returning a func sending what they hold
+func registerReporters(e envVar) (func(), error) {
+	opts := web.ReporterOptions{SampleRate: e.ErrorReportSampleRate}
+	var registered []*web.BatchReporter
+
+	if e.ErrorWebhookURL != "" {
+		webhook := web.NewWebhookReporter(e.ErrorWebhookURL, &http.Client{Timeout: errorWebhookTimeout}, web.BatchOptions{})
+		web.RegisterReporter(webhook, opts)
+		registered = append(registered, webhook)
+		log.Println("error webhook enabled")
+	}
+	if e.ErrorReportFile != "" {
+		file, err := web.NewFileReporter(e.ErrorReportFile, web.BatchOptions{})
+		if err != nil {
+			return nil, err
+		}
+		web.RegisterReporter(file, opts)
+		registered = append(registered, file)
+		log.Printf("errors reported to %s", e.ErrorReportFile)
+	}
+
+	return func() {
+		for _, r := range registered {
+			r.Close()
+		}
+	}, nil
 }
 
+const (
+	// marvelRetries is kept low as a client is waiting for the read through
+	marvelRetries = 1
+	// marvelRetryInterval is short for the same reason
+	marvelRetryInterval = 200 * time.Millisecond
+	// usageFlushInterval is how often the usage of the API clients is written to the DB
+	usageFlushInterval = time.Minute
+	// errorWebhookTimeout bounds each call to the error webhook
+	errorWebhookTimeout = 5 * time.Second
+)
+
+const (
+	storagePostgres = "postgres"
+	storageFile     = "file"
+	storageMemory   = "memory"
+)
+
 type envVar struct {
-	DBAddr string `env:"DATABASE_URL"`
+	// Storage is where the characters are kept, the file and memory storages needing no DB
+	// but doing without the API keys and the admin API
+	Storage string `env:"STORAGE,default=postgres,oneof=postgres file memory"`
+	// StorageFile is the JSON snapshot of the file storage
+	StorageFile string `env:"STORAGE_FILE,optional"`
+	// DBAddr is needed by the postgres storage only
+	DBAddr string `env:"DATABASE_URL,optional,secret"`
+	// Pool is the config of the connection pool of DBAddr and of each replica, e.g. DATABASE_MAX_OPEN_CONNS
+	Pool database.Pool `env:"DATABASE"`
+	// DBReplicaAddrs are the read replicas of DBAddr the characters are read from, the writes going to DBAddr
+	DBReplicaAddrs []string `env:"DATABASE_REPLICA_URL,optional,secret"`
+	// Replicas is the config of the routing to the replicas, e.g. DATABASE_REPLICA_MAX_LAG
+	Replicas database.RouterOptions `env:"DATABASE_REPLICA"`
+	// ReadThrough is to fetch characters missing from the DB from marvel
+	ReadThrough bool `env:"READ_THROUGH,default=false"`
+	// CacheTTL is how long results are kept in memory, caching is disabled if not positive
+	CacheTTL        time.Duration `env:"CACHE_TTL,optional"`
+	CacheMaxEntries int           `env:"CACHE_MAX_ENTRIES,default=5000,min=1"`
+	// CacheControl is the Cache-Control header of successful responses, not set if empty
+	CacheControl string `env:"CACHE_CONTROL,optional"`
+	// CompressionMinSize is the size in bytes from which responses are compressed
+	CompressionMinSize int `env:"COMPRESSION_MIN_SIZE,default=1024,min=0"`
+	// APIKeyAuth is to require an API key from the clients, see api_clients
+	APIKeyAuth bool `env:"API_KEY_AUTH,default=false"`
+	// AdminTokens are the bearer tokens of the admin API, which is disabled if there is none.
+	// Listing the new and old token allows rotating it without downtime
+	AdminTokens []string `env:"ADMIN_TOKEN,optional,secret"`
+	// ErrorWebhookURL is where 5xx errors are POSTed in batches, not done if empty
+	ErrorWebhookURL string `env:"ERROR_WEBHOOK_URL,optional,url,secret"`
+	// ErrorReportFile is the JSONL file 5xx errors are appended to, not done if empty
+	ErrorReportFile string `env:"ERROR_REPORT_FILE,optional"`
+	// ErrorReportSampleRate is the share of 5xx errors reported, from 0 exclusive to 1, all if 0
+	ErrorReportSampleRate float64 `env:"ERROR_REPORT_SAMPLE_RATE,optional,min=0,max=1"`
+	// ReadyMaxSyncAge is how old the last sync may be for serverd to be ready, not checked if not positive
+	ReadyMaxSyncAge time.Duration `env:"READY_MAX_SYNC_AGE,optional"`
+	// Server is the config of the HTTP server, e.g. SERVER_ADDR
+	Server server.Config `env:"SERVER"`
+	// ProbeAddr is where the probes and metrics are served, over TLS too should the API be
+	ProbeAddr string `env:"PROBE_ADDR,default=:9091"`
+	// OpsAddr is where pprof and the admin API are served, over TLS too should the API be.
+	// It is bound to the loopback interface unless set otherwise, as pprof needs no auth
+	OpsAddr string `env:"OPS_ADDR,default=127.0.0.1:9090"`
+}
+
+// replicaRouter returns the router of the reads to the replicas, nil if there is none
+func replicaRouter(primary *sqlx.DB, e envVar) (*database.Router, error) {
+	if len(e.DBReplicaAddrs) == 0 {
+		return nil, nil
+	}
+
+	replicas := make([]*sqlx.DB, len(e.DBReplicaAddrs))
+	for i, addr := range e.DBReplicaAddrs {
+		db, err := database.Open(addr, e.Pool)
+		if err != nil {
+			return nil, fmt.Errorf("replica%d: %v", i, err)
+		}
+		replicas[i] = db
+	}
+
+	router := database.NewRouter(primary, replicas, e.Replicas)
+	router.CheckAll(context.Background())
+	go router.Run(context.Background())
+	log.Printf("reading from %d replicas", len(replicas))
+	return router, nil
+}
+
+// check returns the errors of the vars needed by others
+func (e envVar) check() error {
+	var errs envvar.Errors
+	switch {
+	case e.Storage == storagePostgres && e.DBAddr == "":
+		errs = append(errs, errors.New("DATABASE_URL not present"))
+	case e.Storage == storageFile && e.StorageFile == "":
+		errs = append(errs, errors.New("STORAGE_FILE not present"))
+	}
+	if e.Storage != storagePostgres && len(e.DBReplicaAddrs) > 0 {
+		errs = append(errs, errors.New("DATABASE_REPLICA_URL: needs the postgres storage"))
+	}
+	if e.Storage != storagePostgres && e.APIKeyAuth {
+		errs = append(errs, errors.New("API_KEY_AUTH: needs the postgres storage"))
+	}
+	if e.Storage != storagePostgres && len(e.AdminTokens) > 0 {
+		errs = append(errs, errors.New("ADMIN_TOKEN: needs the postgres storage"))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+type marvelEnvVar struct {
+	PublicKey   string        `env:"PUBLIC_KEY"`
+	PrivateKey  string        `env:"PRIVATE_KEY,secret"`
+	APIAddr     string        `env:"MARVEL_API_URL,url"`
+	NegativeTTL time.Duration `env:"READ_THROUGH_NEGATIVE_TTL,default=5m"`
+	// Timeout bounds each request to Marvel, as a client is waiting for it
+	Timeout time.Duration `env:"READ_THROUGH_TIMEOUT,default=5s,min=1ms"`
 }
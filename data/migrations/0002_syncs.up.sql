@@ -0,0 +1,6 @@
+CREATE TABLE "public"."syncs"
+(
+    id              SERIAL PRIMARY KEY,
+    character_count INTEGER     NOT NULL,
+    completed_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
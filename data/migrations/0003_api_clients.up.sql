@@ -0,0 +1,12 @@
+CREATE TABLE "public"."api_clients"
+(
+    id            SERIAL PRIMARY KEY,
+    name          TEXT             NOT NULL,
+    key_prefix    TEXT             NOT NULL,
+    key_hash      TEXT UNIQUE      NOT NULL,
+    rate_limit    DOUBLE PRECISION NOT NULL,
+    burst         INTEGER          NOT NULL,
+    request_count BIGINT           NOT NULL DEFAULT 0,
+    last_used_at  TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT now()
+);
@@ -0,0 +1,3 @@
+ALTER TABLE "public"."api_clients"
+    DROP COLUMN IF EXISTS scopes,
+    DROP COLUMN IF EXISTS suspended_at;
@@ -0,0 +1,3 @@
+ALTER TABLE "public"."api_clients"
+    ADD COLUMN scopes       TEXT[] NOT NULL DEFAULT '{characters:read}',
+    ADD COLUMN suspended_at TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL migrations of the DB, named NNNN_name.up.sql and NNNN_name.down.sql
+package migrations
+
+import "embed"
+
+// FS holds the migrations
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,154 @@
+package apiclients
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	keyPrefix   = "mf_"
+	keyBytes    = 24
+	prefixChars = 8
+)
+
+// Client is a consumer of serverd identified by an API key, only the hash of which is kept
+type Client struct {
+	ID           int        `db:"id"`
+	Name         string     `db:"name"`
+	KeyPrefix    string     `db:"key_prefix"`
+	KeyHash      string     `db:"key_hash"`
+	RateLimit    float64    `db:"rate_limit"`
+	Burst        int        `db:"burst"`
+	RequestCount int64      `db:"request_count"`
+	LastUsedAt   *time.Time `db:"last_used_at"`
+	CreatedAt    time.Time  `db:"created_at"`
+	// Scopes are what the client is allowed to do, e.g. characters:read
+	Scopes      pq.StringArray `db:"scopes"`
+	SuspendedAt *time.Time     `db:"suspended_at"`
+}
+
+// HasScope tells if the client is allowed the scope
+func (c Client) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+const columns = `id, name, key_prefix, key_hash, rate_limit, burst, request_count, last_used_at, created_at, scopes, suspended_at`
+
+// GenerateKey returns a new random API key, and its prefix which is safe to display
+func GenerateKey() (key string, prefix string, err error) {
+	b := make([]byte, keyBytes)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = keyPrefix + hex.EncodeToString(b)
+	return key, key[:len(keyPrefix)+prefixChars], nil
+}
+
+// HashKey returns the hash of the API key stored in the DB
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Insert inserts the client, setting its ID and creation time
+func Insert(ctx context.Context, db sqlx.QueryerContext, c *Client) error {
+	if c.Scopes == nil {
+		c.Scopes = pq.StringArray{}
+	}
+	return db.QueryRowxContext(ctx,
+		`INSERT INTO api_clients (name, key_prefix, key_hash, rate_limit, burst, scopes) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		c.Name, c.KeyPrefix, c.KeyHash, c.RateLimit, c.Burst, c.Scopes,
+	).Scan(&c.ID, &c.CreatedAt)
+}
+
+// Get returns the client with the given ID, sql.ErrNoRows if there is none
+func Get(ctx context.Context, db sqlx.QueryerContext, id int) (Client, error) {
+	var c Client
+	if err := sqlx.GetContext(ctx, db, &c, `SELECT `+columns+` FROM api_clients WHERE id = $1`, id); err != nil {
+		return Client{}, err
+	}
+	return c, nil
+}
+
+// List returns all the clients ordered by ID
+func List(ctx context.Context, db sqlx.QueryerContext) ([]Client, error) {
+	clients := make([]Client, 0)
+	if err := sqlx.SelectContext(ctx, db, &clients, `SELECT `+columns+` FROM api_clients ORDER BY id`); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// Update sets the name, rate limit, burst and scopes of the client in a single statement, nil ones being
+// left as they are so that concurrent updates of different fields do not undo one another.
+// sql.ErrNoRows is returned if there is no such client
+func Update(ctx context.Context, db sqlx.ExecerContext, id int, name *string, rateLimit *float64, burst *int, scopes []string) error {
+	return execOne(ctx, db,
+		`UPDATE api_clients SET name = COALESCE($2, name), rate_limit = COALESCE($3, rate_limit), burst = COALESCE($4, burst), scopes = COALESCE($5, scopes) WHERE id = $1`,
+		id, name, rateLimit, burst, pq.StringArray(scopes),
+	)
+}
+
+// UpdateKey replaces the key of the client, sql.ErrNoRows is returned if there is none
+func UpdateKey(ctx context.Context, db sqlx.ExecerContext, id int, prefix, hash string) error {
+	return execOne(ctx, db, `UPDATE api_clients SET key_prefix = $2, key_hash = $3 WHERE id = $1`, id, prefix, hash)
+}
+
+// SetSuspended suspends or resumes the client, sql.ErrNoRows is returned if there is none
+func SetSuspended(ctx context.Context, db sqlx.ExecerContext, id int, suspended bool) error {
+	if suspended {
+		return execOne(ctx, db, `UPDATE api_clients SET suspended_at = COALESCE(suspended_at, now()) WHERE id = $1`, id)
+	}
+	return execOne(ctx, db, `UPDATE api_clients SET suspended_at = NULL WHERE id = $1`, id)
+}
+
+// Delete deletes the client, sql.ErrNoRows is returned if there is none
+func Delete(ctx context.Context, db sqlx.ExecerContext, id int) error {
+	return execOne(ctx, db, `DELETE FROM api_clients WHERE id = $1`, id)
+}
+
+// execOne runs a statement expected to affect a single row
+func execOne(ctx context.Context, db sqlx.ExecerContext, query string, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetByKeyHash returns the client with the given key hash, sql.ErrNoRows if there is none
+func GetByKeyHash(ctx context.Context, db sqlx.QueryerContext, hash string) (Client, error) {
+	var c Client
+	if err := sqlx.GetContext(ctx, db, &c, `SELECT `+columns+` FROM api_clients WHERE key_hash = $1`, hash); err != nil {
+		return Client{}, err
+	}
+	return c, nil
+}
+
+// AddUsage adds count requests made until lastUsed to the usage of the client
+func AddUsage(ctx context.Context, db sqlx.ExecerContext, id int, count int64, lastUsed time.Time) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE api_clients SET request_count = request_count + $2, last_used_at = GREATEST(last_used_at, $3) WHERE id = $1`,
+		id, count, lastUsed,
+	)
+	return err
+}
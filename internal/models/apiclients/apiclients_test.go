@@ -0,0 +1,133 @@
+package apiclients
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestGenerateKey(t *testing.T) {
+	key, prefix, err := GenerateKey()
+	testutil.Ok(t, err)
+	testutil.Asserts(t, strings.HasPrefix(key, prefix), "key %s should start with %s", key, prefix)
+	testutil.Equals(t, len(keyPrefix)+2*keyBytes, len(key))
+
+	other, _, err := GenerateKey()
+	testutil.Ok(t, err)
+	testutil.Asserts(t, key != other, "keys should be random")
+	testutil.Asserts(t, HashKey(key) != HashKey(other), "hashes should differ")
+	testutil.Equals(t, HashKey(key), HashKey(key))
+}
+
+func TestGetByKeyHash(t *testing.T) {
+	requireDB(t)
+
+	tests := []struct {
+		name    string
+		fixture *Client
+		hash    string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "not found",
+			fixture: nil,
+			hash:    HashKey("mf_nope"),
+			wantErr: sql.ErrNoRows.Error(),
+		},
+		{
+			name:    "found",
+			fixture: &Client{Name: "analytics", KeyPrefix: "mf_0123", KeyHash: HashKey("mf_0123456"), RateLimit: 10, Burst: 20},
+			hash:    HashKey("mf_0123456"),
+			want:    "analytics",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := db.MustBegin()
+			tx.MustExec(`TRUNCATE api_clients`)
+			if tt.fixture != nil {
+				testutil.Ok(t, Insert(context.TODO(), tx, tt.fixture))
+				testutil.Asserts(t, tt.fixture.ID != 0, "ID should be set")
+			}
+			got, err := GetByKeyHash(context.TODO(), tx, tt.hash)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want, got.Name)
+				testutil.Equals(t, tt.fixture.ID, got.ID)
+			}
+			testutil.Ok(t, tx.Rollback())
+		})
+	}
+}
+
+func TestAddUsage(t *testing.T) {
+	requireDB(t)
+
+	tx := db.MustBegin()
+	tx.MustExec(`TRUNCATE api_clients`)
+	c := &Client{Name: "analytics", KeyPrefix: "mf_0123", KeyHash: HashKey("mf_0123456"), RateLimit: 10, Burst: 20}
+	testutil.Ok(t, Insert(context.TODO(), tx, c))
+
+	now := time.Now()
+	testutil.Ok(t, AddUsage(context.TODO(), tx, c.ID, 3, now))
+	testutil.Ok(t, AddUsage(context.TODO(), tx, c.ID, 4, now.Add(-time.Hour)))
+
+	got, err := GetByKeyHash(context.TODO(), tx, c.KeyHash)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(7), got.RequestCount)
+	testutil.Asserts(t, got.LastUsedAt != nil, "last used should be set")
+	testutil.CheckTimeApproximately(t, now, *got.LastUsedAt)
+	testutil.Ok(t, tx.Rollback())
+}
+
+func TestClient_lifecycle(t *testing.T) {
+	requireDB(t)
+
+	tx := db.MustBegin()
+	tx.MustExec(`TRUNCATE api_clients`)
+
+	c := &Client{Name: "analytics", KeyPrefix: "mf_0123", KeyHash: HashKey("mf_0123456"), RateLimit: 10, Burst: 20, Scopes: []string{"characters:read"}}
+	testutil.Ok(t, Insert(context.TODO(), tx, c))
+	other := &Client{Name: "search", KeyPrefix: "mf_4567", KeyHash: HashKey("mf_4567890"), RateLimit: 1, Burst: 1}
+	testutil.Ok(t, Insert(context.TODO(), tx, other))
+
+	all, err := List(context.TODO(), tx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(all))
+	testutil.Equals(t, "analytics", all[0].Name)
+	testutil.Asserts(t, all[0].HasScope("characters:read"), "scope should be kept")
+	testutil.Asserts(t, !all[1].HasScope("characters:read"), "no scope was given")
+
+	name, rateLimit, burst := "reporting", 5.0, 6
+	testutil.Ok(t, Update(context.TODO(), tx, c.ID, nil, &rateLimit, nil, []string{"characters:read", "characters:export"}))
+	testutil.Ok(t, Update(context.TODO(), tx, c.ID, &name, nil, &burst, nil))
+	testutil.Ok(t, UpdateKey(context.TODO(), tx, c.ID, "mf_89ab", HashKey("mf_89abcde")))
+	testutil.Ok(t, SetSuspended(context.TODO(), tx, c.ID, true))
+
+	got, err := Get(context.TODO(), tx, c.ID)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "reporting", got.Name)
+	testutil.Equals(t, 5.0, got.RateLimit)
+	testutil.Equals(t, 6, got.Burst)
+	testutil.Asserts(t, got.HasScope("characters:export"), "scopes should be updated")
+	testutil.Equals(t, HashKey("mf_89abcde"), got.KeyHash)
+	testutil.Asserts(t, got.SuspendedAt != nil, "should be suspended")
+
+	testutil.Ok(t, SetSuspended(context.TODO(), tx, c.ID, false))
+	got, err = Get(context.TODO(), tx, c.ID)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, got.SuspendedAt == nil, "should be resumed")
+
+	testutil.Ok(t, Delete(context.TODO(), tx, c.ID))
+	_, err = Get(context.TODO(), tx, c.ID)
+	testutil.CompareError(t, sql.ErrNoRows.Error(), err)
+	testutil.CompareError(t, sql.ErrNoRows.Error(), Delete(context.TODO(), tx, c.ID))
+	testutil.CompareError(t, sql.ErrNoRows.Error(), SetSuspended(context.TODO(), tx, c.ID, true))
+
+	testutil.Ok(t, tx.Rollback())
+}
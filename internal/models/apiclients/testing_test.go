@@ -0,0 +1,50 @@
+package apiclients
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/marvel-forwarder/data/migrations"
+	"github.com/kagelui/marvel-forwarder/internal/models/schema"
+	_ "github.com/lib/pq"
+)
+
+var db *sqlx.DB
+
+func TestMain(m *testing.M) {
+	// without a DB, only the tests not needing one are run, see requireDB
+	v, ok := os.LookupEnv("DATABASE_URL")
+	if !ok {
+		os.Exit(m.Run())
+	}
+	var err error
+	db, err = sqlx.Connect("postgres", v)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(2)
+	}
+	defer db.Close()
+
+	// the tests run against the schema of the embedded migrations, without the migrate container
+	migrator, err := schema.NewMigrator(db, migrations.FS)
+	if err == nil {
+		_, err = migrator.Up(context.Background())
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(3)
+	}
+
+	os.Exit(m.Run())
+}
+
+// requireDB skips the test should there be no DATABASE_URL to run it against
+func requireDB(t *testing.T) {
+	t.Helper()
+	if db == nil {
+		t.Skip("DATABASE_URL not set")
+	}
+}
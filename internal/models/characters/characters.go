@@ -2,10 +2,15 @@ package characters
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/metrics"
+	"github.com/lib/pq"
 )
 
 // Character contains the information of a character used in this app
@@ -15,6 +20,54 @@ type Character struct {
 	Description string `db:"description"`
 }
 
+// Field is a field of Character which can be read on its own
+type Field string
+
+const (
+	FieldID          Field = "id"
+	FieldName        Field = "name"
+	FieldDescription Field = "description"
+)
+
+// Fields are all the fields of Character, in order
+var Fields = []Field{FieldID, FieldName, FieldDescription}
+
+// columns are the columns of the fields
+var columns = map[Field]string{
+	FieldID:          "external_id",
+	FieldName:        "name",
+	FieldDescription: "description",
+}
+
+// CheckFields returns an error for the first unknown field
+func CheckFields(fields []Field) error {
+	for _, f := range fields {
+		if _, ok := columns[f]; !ok {
+			return fmt.Errorf("unknown field %q", f)
+		}
+	}
+	return nil
+}
+
+// Project returns the character with only the fields, the others being left zero, or as is if there is no field
+func (c Character) Project(fields ...Field) Character {
+	if len(fields) == 0 {
+		return c
+	}
+	var p Character
+	for _, f := range fields {
+		switch f {
+		case FieldID:
+			p.ID = c.ID
+		case FieldName:
+			p.Name = c.Name
+		case FieldDescription:
+			p.Description = c.Description
+		}
+	}
+	return p
+}
+
 // CharacterSlice represents a slice of characters
 type CharacterSlice []Character
 
@@ -24,12 +77,14 @@ func (s CharacterSlice) Save(ctx context.Context, db *sqlx.DB) error {
 		return nil
 	}
 
-	tx, err := db.Beginx()
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
 	if err = s.SaveWithTx(ctx, tx); err != nil {
+		// else the connection is not given back to the pool
+		_ = tx.Rollback()
 		return err
 	}
 
@@ -41,6 +96,7 @@ func (s CharacterSlice) SaveWithTx(ctx context.Context, tx *sqlx.Tx) error {
 	if len(s) == 0 {
 		return nil
 	}
+	defer queryDuration.ObserveSince(time.Now(), "save_characters")
 
 	u := unique(s)
 	insertQuery := `INSERT INTO characters (external_id, name, description) VALUES `
@@ -55,7 +111,22 @@ func (s CharacterSlice) SaveWithTx(ctx context.Context, tx *sqlx.Tx) error {
 	insertQuery += strings.Join(positionStrSlice, ", ")
 	insertQuery += ` ON CONFLICT (external_id) DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description`
 
-	_, err := tx.ExecContext(ctx, insertQuery, insertParams...)
+	if _, err := tx.ExecContext(ctx, insertQuery, insertParams...); err != nil {
+		return err
+	}
+	rowsUpserted.Add(float64(len(u)))
+	return nil
+}
+
+// DeleteOthersWithTx deletes the characters whose external ID is not in the slice with a *sqlx.Tx
+func (s CharacterSlice) DeleteOthersWithTx(ctx context.Context, tx *sqlx.Tx) error {
+	defer queryDuration.ObserveSince(time.Now(), "delete_characters")
+
+	ids := make([]int64, len(s))
+	for i, c := range s {
+		ids[i] = int64(c.ID)
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM characters WHERE external_id <> ALL($1)`, pq.Array(ids))
 	return err
 }
 
@@ -79,6 +150,8 @@ type Inquirer interface {
 
 // GetCharacter returns the Character struct for the given external ID
 func GetCharacter(ctx context.Context, db Inquirer, extID int) (Character, error) {
+	defer queryDuration.ObserveSince(time.Now(), "get_character")
+
 	var ch Character
 	if err := db.GetContext(ctx, &ch, "SELECT external_id, name, description FROM characters WHERE external_id = $1", extID); err != nil {
 		return Character{}, err
@@ -86,11 +159,114 @@ func GetCharacter(ctx context.Context, db Inquirer, extID int) (Character, error
 	return ch, nil
 }
 
-// GetCharacters returns all Character in the DB
-func GetCharacters(ctx context.Context, db Inquirer) ([]Character, error) {
+// GetCharacters returns all Character in the DB, ordered by external ID, with only the columns of the fields,
+// or all of them if there is no field
+func GetCharacters(ctx context.Context, db Inquirer, fields ...Field) ([]Character, error) {
+	if err := CheckFields(fields); err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		fields = Fields
+	}
+	cols := make([]string, len(fields))
+	for i, f := range fields {
+		cols[i] = columns[f]
+	}
+
+	defer queryDuration.ObserveSince(time.Now(), "get_characters")
+
 	characters := make([]Character, 0)
-	if err := db.SelectContext(ctx, &characters, `SELECT external_id, name, description FROM characters ORDER BY external_id`); err != nil {
+	query := `SELECT ` + strings.Join(cols, ", ") + ` FROM characters ORDER BY external_id`
+	if err := db.SelectContext(ctx, &characters, query); err != nil {
 		return nil, err
 	}
 	return characters, nil
 }
+
+// GetCatalogue returns all the characters, ordered by external ID, and the latest sync, both read in
+// a single read only transaction so that they match
+func GetCatalogue(ctx context.Context, db *sqlx.DB) (Catalogue, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return Catalogue{}, err
+	}
+	// nothing is written, so rolling back is as good as committing
+	defer tx.Rollback()
+
+	var c Catalogue
+	s, err := LatestSync(ctx, tx)
+	switch {
+	case err == nil:
+		c.Sync = &s
+	case !errors.Is(err, sql.ErrNoRows):
+		return Catalogue{}, err
+	}
+	if c.Characters, err = GetCharacters(ctx, tx); err != nil {
+		return Catalogue{}, err
+	}
+	return c, nil
+}
+
+// cursorBatch is how many characters are fetched at once by EachCharacter
+const cursorBatch = 500
+
+// EachCharacter calls fn with every Character in the DB, ordered by external ID, fetching them in batches
+// from a cursor so that they are never all held in memory. It stops at the first error of fn
+func EachCharacter(ctx context.Context, db *sqlx.DB, fn func(Character) error) error {
+	// only the time spent on the DB is observed, fn being paced by whoever reads the characters
+	var spent time.Duration
+	defer func() { queryDuration.Observe(spent.Seconds(), "each_character") }()
+
+	start := time.Now()
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	// nothing is written, so rolling back is as good as committing
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DECLARE each_character NO SCROLL CURSOR FOR
+		SELECT external_id, name, description FROM characters ORDER BY external_id`)
+	spent += time.Since(start)
+	if err != nil {
+		return err
+	}
+	fetch := fmt.Sprintf(`FETCH %d FROM each_character`, cursorBatch)
+	batch := make([]Character, 0, cursorBatch)
+	for {
+		batch = batch[:0]
+		start = time.Now()
+		err = tx.SelectContext(ctx, &batch, fetch)
+		spent += time.Since(start)
+		if err != nil {
+			return err
+		}
+		for _, ch := range batch {
+			if err = fn(ch); err != nil {
+				return err
+			}
+		}
+		if len(batch) < cursorBatch {
+			return nil
+		}
+	}
+}
+
+var (
+	// queryDuration times the queries of this package, per query
+	queryDuration = metrics.NewHistogram("db_query_duration_seconds",
+		"Latency of the queries to the DB, per query.", metrics.DefBuckets, "query")
+	rowsUpserted = metrics.NewCounter("characters_upserted_total",
+		"Characters inserted or updated, the transaction may have been rolled back since.")
+)
+
+// SyncedChannel is the PostgreSQL channel notified once a sync of the characters is committed
+const SyncedChannel = "characters_synced"
+
+// NotifySynced tells the listeners of SyncedChannel that the characters have changed
+func NotifySynced(ctx context.Context, db sqlx.ExecerContext) error {
+	defer queryDuration.ObserveSince(time.Now(), "notify_synced")
+
+	_, err := db.ExecContext(ctx, `SELECT pg_notify($1, '')`, SyncedChannel)
+	return err
+}
@@ -2,12 +2,16 @@ package characters
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/kagelui/marvel-forwarder/internal/testutil"
 )
 
 func TestCharacterSlice_saveWithTx(t *testing.T) {
+	requireDB(t)
+
 	tests := []struct {
 		name    string
 		fixture CharacterSlice
@@ -135,10 +139,22 @@ func TestCharacterSlice_saveWithTx(t *testing.T) {
 	}
 }
 
+func TestCharacterSlice_Save_error(t *testing.T) {
+	requireDB(t)
+
+	// PostgreSQL refuses NUL in text
+	err := CharacterSlice{{ID: 1, Name: "nul\x00"}}.Save(context.TODO(), db)
+	testutil.Asserts(t, err != nil, "the save should fail")
+	testutil.Equals(t, 0, db.Stats().InUse)
+}
+
 func TestGetCharacters(t *testing.T) {
+	requireDB(t)
+
 	tests := []struct {
 		name    string
 		fixture CharacterSlice
+		fields  []Field
 		want    []Character
 		wantErr string
 	}{
@@ -186,13 +202,30 @@ func TestGetCharacters(t *testing.T) {
 			},
 			wantErr: "",
 		},
+		{
+			name: "only some fields",
+			fixture: []Character{
+				{ID: 941356, Name: "Daredevil", Description: "some broke lawyer"},
+				{ID: 186824, Name: "Stick", Description: "teacher to some broke lawyer"},
+			},
+			fields: []Field{FieldName, FieldID},
+			want: []Character{
+				{ID: 186824, Name: "Stick"},
+				{ID: 941356, Name: "Daredevil"},
+			},
+		},
+		{
+			name:    "unknown field",
+			fields:  []Field{FieldID, "comics"},
+			wantErr: `unknown field "comics"`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tx := db.MustBegin()
 			tx.MustExec(`TRUNCATE characters`)
 			testutil.Ok(t, tt.fixture.SaveWithTx(context.TODO(), tx))
-			got, err := GetCharacters(context.TODO(), tx)
+			got, err := GetCharacters(context.TODO(), tx, tt.fields...)
 			testutil.CompareError(t, tt.wantErr, err)
 			if err == nil {
 				testutil.Equals(t, tt.want, got)
@@ -201,3 +234,57 @@ func TestGetCharacters(t *testing.T) {
 		})
 	}
 }
+
+func TestEachCharacter(t *testing.T) {
+	requireDB(t)
+
+	// more than a batch, so that the cursor is fetched from more than once
+	fixture := make(CharacterSlice, cursorBatch+1)
+	for i := range fixture {
+		fixture[i] = Character{ID: len(fixture) - i, Name: fmt.Sprintf("character %d", i)}
+	}
+	db.MustExec(`TRUNCATE characters`)
+	defer db.MustExec(`TRUNCATE characters`)
+	testutil.Ok(t, fixture.Save(context.TODO(), db))
+
+	var ids []int
+	testutil.Ok(t, EachCharacter(context.TODO(), db, func(ch Character) error {
+		ids = append(ids, ch.ID)
+		return nil
+	}))
+	testutil.Equals(t, len(fixture), len(ids))
+	for i, id := range ids {
+		testutil.Equals(t, i+1, id)
+	}
+
+	stop := errors.New("stop")
+	err := EachCharacter(context.TODO(), db, func(ch Character) error { return stop })
+	testutil.Asserts(t, err == stop, "the error of fn should be returned, got %v", err)
+}
+
+func TestGetCatalogue(t *testing.T) {
+	requireDB(t)
+
+	db.MustExec(`TRUNCATE characters, syncs`)
+	defer db.MustExec(`TRUNCATE characters, syncs`)
+
+	c, err := GetCatalogue(context.TODO(), db)
+	testutil.Ok(t, err)
+	testutil.Equals(t, Catalogue{Characters: []Character{}}, c)
+
+	fixture := CharacterSlice{{ID: 2, Name: "two"}, {ID: 1, Name: "one"}}
+	testutil.Ok(t, (&Postgres{DB: db}).SaveSync(context.TODO(), fixture))
+	c, err = GetCatalogue(context.TODO(), db)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, c.Sync != nil, "the sync should be read")
+	testutil.Equals(t, 2, c.Sync.CharacterCount)
+	testutil.Equals(t, []Character{{ID: 1, Name: "one"}, {ID: 2, Name: "two"}}, c.Characters)
+}
+
+func TestNotifySynced(t *testing.T) {
+	requireDB(t)
+
+	tx := db.MustBegin()
+	testutil.Ok(t, NotifySynced(context.TODO(), tx))
+	testutil.Ok(t, tx.Rollback())
+}
@@ -0,0 +1,176 @@
+package characters
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// File is the Repository kept in memory and written to a JSON snapshot file after every change,
+// so that serverd runs without a DB and keeps its characters across restarts
+type File struct {
+	path string
+
+	// mu keeps the writes of the file in the order of the changes
+	mu     sync.Mutex
+	memory *Memory
+}
+
+// snapshot is the content of the file of File
+type snapshot struct {
+	Characters []snapshotCharacter `json:"characters"`
+	Syncs      []snapshotSync      `json:"syncs"`
+}
+
+type snapshotCharacter struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type snapshotSync struct {
+	ID             int       `json:"id"`
+	CharacterCount int       `json:"character_count"`
+	CompletedAt    time.Time `json:"completed_at"`
+}
+
+// OpenFile returns the File of the snapshot at path, empty should there be no file yet
+func OpenFile(path string) (*File, error) {
+	f := &File{path: path, memory: NewMemory()}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var s snapshot
+	if err = json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	f.memory.restore(s)
+	return f, nil
+}
+
+// GetCharacter returns the character with the given external ID, or ErrNotFound
+func (f *File) GetCharacter(ctx context.Context, id int) (Character, error) {
+	return f.memory.GetCharacter(ctx, id)
+}
+
+// GetCharacters returns all the characters, ordered by external ID, with only the fields
+func (f *File) GetCharacters(ctx context.Context, fields ...Field) ([]Character, error) {
+	return f.memory.GetCharacters(ctx, fields...)
+}
+
+// EachCharacter calls fn with every character, ordered by external ID
+func (f *File) EachCharacter(ctx context.Context, fn func(Character) error) error {
+	return f.memory.EachCharacter(ctx, fn)
+}
+
+// GetCatalogue returns all the characters, ordered by external ID, and the latest sync
+func (f *File) GetCatalogue(ctx context.Context) (Catalogue, error) {
+	return f.memory.GetCatalogue(ctx)
+}
+
+// LatestSync returns the latest successful sync, or ErrNotFound
+func (f *File) LatestSync(ctx context.Context) (Sync, error) {
+	return f.memory.LatestSync(ctx)
+}
+
+// SaveCharacters upserts the characters and writes the file
+func (f *File) SaveCharacters(ctx context.Context, chs CharacterSlice) error {
+	return f.change(func() error { return f.memory.SaveCharacters(ctx, chs) })
+}
+
+// SaveSync upserts the characters, records the sync and writes the file
+func (f *File) SaveSync(ctx context.Context, chs CharacterSlice) error {
+	return f.change(func() error { return f.memory.SaveSync(ctx, chs) })
+}
+
+// ReplaceSync replaces the characters, records the sync and writes the file
+func (f *File) ReplaceSync(ctx context.Context, chs CharacterSlice) error {
+	return f.change(func() error { return f.memory.ReplaceSync(ctx, chs) })
+}
+
+// change applies fn to the memory and writes the file, the memory is restored should the file not be written
+func (f *File) change(fn func() error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	before := f.memory.snapshot()
+	if err := fn(); err != nil {
+		return err
+	}
+	if err := f.write(f.memory.snapshot()); err != nil {
+		f.memory.restore(before)
+		return err
+	}
+	return nil
+}
+
+// write replaces the file with a temporary one, so that it is never left half written
+func (f *File) write(s snapshot) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func (m *Memory) snapshot() snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s := snapshot{
+		Characters: make([]snapshotCharacter, 0, len(m.characters)),
+		Syncs:      make([]snapshotSync, len(m.syncs)),
+	}
+	for _, ch := range m.characters {
+		s.Characters = append(s.Characters, snapshotCharacter{ID: ch.ID, Name: ch.Name, Description: ch.Description})
+	}
+	// sorted to keep the diffs of the file small
+	sort.Slice(s.Characters, func(i, j int) bool { return s.Characters[i].ID < s.Characters[j].ID })
+	for i, sy := range m.syncs {
+		s.Syncs[i] = snapshotSync{ID: sy.ID, CharacterCount: sy.CharacterCount, CompletedAt: sy.CompletedAt}
+	}
+	return s
+}
+
+func (m *Memory) restore(s snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.characters = make(map[int]Character, len(s.Characters))
+	for _, ch := range s.Characters {
+		m.characters[ch.ID] = Character{ID: ch.ID, Name: ch.Name, Description: ch.Description}
+	}
+	m.syncs = make([]Sync, len(s.Syncs))
+	for i, sy := range s.Syncs {
+		m.syncs[i] = Sync{ID: sy.ID, CharacterCount: sy.CharacterCount, CompletedAt: sy.CompletedAt}
+	}
+}
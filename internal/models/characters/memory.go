@@ -0,0 +1,130 @@
+package characters
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is the Repository kept in memory, for tests and demos
+type Memory struct {
+	mu         sync.RWMutex
+	characters map[int]Character
+	syncs      []Sync
+}
+
+// NewMemory returns an empty Memory
+func NewMemory() *Memory {
+	return &Memory{characters: make(map[int]Character)}
+}
+
+// GetCharacter returns the character with the given external ID, or ErrNotFound
+func (m *Memory) GetCharacter(_ context.Context, id int) (Character, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ch, ok := m.characters[id]
+	if !ok {
+		return Character{}, ErrNotFound
+	}
+	return ch, nil
+}
+
+// GetCharacters returns all the characters, ordered by external ID, with only the fields
+func (m *Memory) GetCharacters(_ context.Context, fields ...Field) ([]Character, error) {
+	if err := CheckFields(fields); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chs := m.sorted()
+	// projected once sorted, as the ID may be left out
+	for i, ch := range chs {
+		chs[i] = ch.Project(fields...)
+	}
+	return chs, nil
+}
+
+// GetCatalogue returns all the characters, ordered by external ID, and the latest sync
+func (m *Memory) GetCatalogue(_ context.Context) (Catalogue, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c := Catalogue{Characters: m.sorted()}
+	if len(m.syncs) > 0 {
+		s := m.syncs[len(m.syncs)-1]
+		c.Sync = &s
+	}
+	return c, nil
+}
+
+// sorted returns a copy of the characters ordered by external ID. m.mu must be held
+func (m *Memory) sorted() []Character {
+	chs := make([]Character, 0, len(m.characters))
+	for _, ch := range m.characters {
+		chs = append(chs, ch)
+	}
+	sort.Slice(chs, func(i, j int) bool { return chs[i].ID < chs[j].ID })
+	return chs
+}
+
+// EachCharacter calls fn with every character, ordered by external ID, from a copy of them so that fn may take its time
+func (m *Memory) EachCharacter(ctx context.Context, fn func(Character) error) error {
+	chs, _ := m.GetCharacters(ctx)
+	for _, ch := range chs {
+		if err := fn(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveCharacters upserts the characters
+func (m *Memory) SaveCharacters(_ context.Context, chs CharacterSlice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.save(chs)
+	return nil
+}
+
+// SaveSync upserts the characters and records the sync
+func (m *Memory) SaveSync(_ context.Context, chs CharacterSlice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.save(chs)
+	m.syncs = append(m.syncs, Sync{ID: len(m.syncs) + 1, CharacterCount: len(chs), CompletedAt: time.Now().UTC()})
+	return nil
+}
+
+// ReplaceSync replaces the characters and records the sync
+func (m *Memory) ReplaceSync(_ context.Context, chs CharacterSlice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.characters = make(map[int]Character, len(chs))
+	m.save(chs)
+	m.syncs = append(m.syncs, Sync{ID: len(m.syncs) + 1, CharacterCount: len(chs), CompletedAt: time.Now().UTC()})
+	return nil
+}
+
+// LatestSync returns the latest successful sync, or ErrNotFound
+func (m *Memory) LatestSync(_ context.Context) (Sync, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.syncs) == 0 {
+		return Sync{}, ErrNotFound
+	}
+	return m.syncs[len(m.syncs)-1], nil
+}
+
+func (m *Memory) save(chs CharacterSlice) {
+	for _, ch := range chs {
+		m.characters[ch.ID] = ch
+	}
+}
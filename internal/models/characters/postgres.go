@@ -0,0 +1,133 @@
+package characters
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/database"
+)
+
+// Postgres is the Repository kept in PostgreSQL
+type Postgres struct {
+	DB *sqlx.DB
+	// Router, if set, routes the reads to the replicas of DB
+	Router *database.Router
+}
+
+// read runs fn against a replica, or DB should there be no Router
+func (p *Postgres) read(ctx context.Context, fn func(db *sqlx.DB) error) error {
+	if p.Router == nil {
+		return fn(p.DB)
+	}
+	return p.Router.Read(ctx, fn)
+}
+
+// GetCharacter returns the character with the given external ID, or ErrNotFound
+func (p *Postgres) GetCharacter(ctx context.Context, id int) (Character, error) {
+	var ch Character
+	err := p.read(ctx, func(db *sqlx.DB) (err error) {
+		ch, err = GetCharacter(ctx, db, id)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Character{}, ErrNotFound
+	}
+	return ch, err
+}
+
+// GetCharacters returns all the characters, ordered by external ID, reading only the columns of the fields
+func (p *Postgres) GetCharacters(ctx context.Context, fields ...Field) ([]Character, error) {
+	// checked first, as a failed read would count against the replica
+	if err := CheckFields(fields); err != nil {
+		return nil, err
+	}
+	var chs []Character
+	err := p.read(ctx, func(db *sqlx.DB) (err error) {
+		chs, err = GetCharacters(ctx, db, fields...)
+		return err
+	})
+	return chs, err
+}
+
+// EachCharacter calls fn with every character from a cursor, ordered by external ID. It is run against a
+// single DB, as what fn has already been given could not be taken back should it fall back to the primary
+func (p *Postgres) EachCharacter(ctx context.Context, fn func(Character) error) error {
+	if p.Router == nil {
+		return EachCharacter(ctx, p.DB, fn)
+	}
+	return p.Router.ReadOnce(ctx, func(db *sqlx.DB) error {
+		return EachCharacter(ctx, db, fn)
+	})
+}
+
+// SaveCharacters upserts the characters in a transaction
+func (p *Postgres) SaveCharacters(ctx context.Context, chs CharacterSlice) error {
+	return chs.Save(ctx, p.DB)
+}
+
+// SaveSync upserts the characters and records the sync in the same transaction
+func (p *Postgres) SaveSync(ctx context.Context, chs CharacterSlice) error {
+	tx, err := p.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = chs.SaveWithTx(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = RecordSync(ctx, tx, len(chs)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceSync deletes the characters missing from chs, upserts the others and records the sync in the same transaction
+func (p *Postgres) ReplaceSync(ctx context.Context, chs CharacterSlice) error {
+	tx, err := p.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = chs.DeleteOthersWithTx(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = chs.SaveWithTx(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = RecordSync(ctx, tx, len(chs)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetCatalogue returns all the characters and the latest sync from the same transaction
+func (p *Postgres) GetCatalogue(ctx context.Context) (Catalogue, error) {
+	var c Catalogue
+	err := p.read(ctx, func(db *sqlx.DB) (err error) {
+		c, err = GetCatalogue(ctx, db)
+		return err
+	})
+	return c, err
+}
+
+// LatestSync returns the latest successful sync, or ErrNotFound
+func (p *Postgres) LatestSync(ctx context.Context) (Sync, error) {
+	var s Sync
+	err := p.read(ctx, func(db *sqlx.DB) (err error) {
+		s, err = LatestSync(ctx, db)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Sync{}, ErrNotFound
+	}
+	return s, err
+}
@@ -0,0 +1,39 @@
+package characters
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned by the repositories for a missing character, or sync should there have been none
+var ErrNotFound = errors.New("not found")
+
+// Repository is where the characters and their syncs are kept
+type Repository interface {
+	// GetCharacter returns the character with the given external ID, or ErrNotFound
+	GetCharacter(ctx context.Context, id int) (Character, error)
+	// GetCharacters returns all the characters, ordered by external ID, with only the fields, the others
+	// being left zero, or with all of them if there is no field
+	GetCharacters(ctx context.Context, fields ...Field) ([]Character, error)
+	// EachCharacter calls fn with every character, ordered by external ID, without holding them all in memory.
+	// It stops at the first error of fn, which is returned
+	EachCharacter(ctx context.Context, fn func(Character) error) error
+	// SaveCharacters inserts the characters, updating those with the same external ID
+	SaveCharacters(ctx context.Context, chs CharacterSlice) error
+	// SaveSync saves the characters and records a successful sync of them at once
+	SaveSync(ctx context.Context, chs CharacterSlice) error
+	// ReplaceSync replaces all the characters with chs and records a sync of them at once
+	ReplaceSync(ctx context.Context, chs CharacterSlice) error
+	// LatestSync returns the latest successful sync, or ErrNotFound
+	LatestSync(ctx context.Context) (Sync, error)
+	// GetCatalogue returns all the characters, ordered by external ID, and the latest successful sync,
+	// read at once so that no sync lands in between
+	GetCatalogue(ctx context.Context) (Catalogue, error)
+}
+
+// Catalogue is all the characters as of the latest sync
+type Catalogue struct {
+	// Sync is the latest successful sync, nil should there have been none
+	Sync       *Sync
+	Characters []Character
+}
@@ -0,0 +1,152 @@
+package characters
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+// testRepository checks the behaviour shared by every Repository, which must be empty
+func testRepository(t *testing.T, repo Repository) {
+	ctx := context.TODO()
+
+	_, err := repo.GetCharacter(ctx, 9312)
+	testutil.Asserts(t, err == ErrNotFound, "a missing character should be ErrNotFound, got %v", err)
+	_, err = repo.LatestSync(ctx)
+	testutil.Asserts(t, err == ErrNotFound, "no sync should be ErrNotFound, got %v", err)
+	chs, err := repo.GetCharacters(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []Character{}, chs)
+	c, err := repo.GetCatalogue(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, Catalogue{Characters: []Character{}}, c)
+
+	testutil.Ok(t, repo.SaveCharacters(ctx, CharacterSlice{
+		{ID: 831624, Name: "girl", Description: "girl0"},
+	}))
+	testutil.Ok(t, repo.SaveSync(ctx, CharacterSlice{
+		{ID: 831624, Name: "woman", Description: "woman0"},
+		{ID: 9312, Name: "man", Description: "man0"},
+	}))
+
+	ch, err := repo.GetCharacter(ctx, 831624)
+	testutil.Ok(t, err)
+	testutil.Equals(t, Character{ID: 831624, Name: "woman", Description: "woman0"}, ch)
+
+	chs, err = repo.GetCharacters(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []Character{
+		{ID: 9312, Name: "man", Description: "man0"},
+		{ID: 831624, Name: "woman", Description: "woman0"},
+	}, chs)
+
+	chs, err = repo.GetCharacters(ctx, FieldDescription)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []Character{{Description: "man0"}, {Description: "woman0"}}, chs)
+	_, err = repo.GetCharacters(ctx, "comics")
+	testutil.CompareError(t, `unknown field "comics"`, err)
+	chs, err = repo.GetCharacters(ctx)
+	testutil.Ok(t, err)
+
+	var each []Character
+	testutil.Ok(t, repo.EachCharacter(ctx, func(ch Character) error {
+		each = append(each, ch)
+		return nil
+	}))
+	testutil.Equals(t, chs, each)
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.EachCharacter(ctx, func(ch Character) error {
+		calls++
+		return stop
+	})
+	testutil.Asserts(t, err == stop, "the error of fn should be returned, got %v", err)
+	testutil.Equals(t, 1, calls)
+
+	testutil.Ok(t, repo.SaveSync(ctx, nil))
+	s, err := repo.LatestSync(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, s.ID)
+	testutil.Equals(t, 0, s.CharacterCount)
+	testutil.Asserts(t, !s.CompletedAt.IsZero(), "the sync should have completed at some point")
+
+	testutil.Ok(t, repo.ReplaceSync(ctx, CharacterSlice{
+		{ID: 9312, Name: "boy", Description: "boy0"},
+		{ID: 72, Name: "old man", Description: "old man0"},
+	}))
+	_, err = repo.GetCharacter(ctx, 831624)
+	testutil.Asserts(t, err == ErrNotFound, "a replaced character should be ErrNotFound, got %v", err)
+	chs, err = repo.GetCharacters(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []Character{
+		{ID: 72, Name: "old man", Description: "old man0"},
+		{ID: 9312, Name: "boy", Description: "boy0"},
+	}, chs)
+	s, err = repo.LatestSync(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, s.ID)
+	testutil.Equals(t, 2, s.CharacterCount)
+
+	c, err = repo.GetCatalogue(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, Catalogue{Sync: &s, Characters: chs}, c)
+}
+
+func TestMemory(t *testing.T) {
+	testRepository(t, NewMemory())
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "characters")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "characters.json")
+
+	f, err := OpenFile(path)
+	testutil.Ok(t, err)
+	testRepository(t, f)
+
+	// everything is read back from the file
+	reopened, err := OpenFile(path)
+	testutil.Ok(t, err)
+	want, err := f.GetCharacters(context.TODO())
+	testutil.Ok(t, err)
+	got, err := reopened.GetCharacters(context.TODO())
+	testutil.Ok(t, err)
+	testutil.Equals(t, want, got)
+	wantSync, err := f.LatestSync(context.TODO())
+	testutil.Ok(t, err)
+	gotSync, err := reopened.LatestSync(context.TODO())
+	testutil.Ok(t, err)
+	testutil.Asserts(t, wantSync.CompletedAt.Equal(gotSync.CompletedAt) && wantSync.ID == gotSync.ID,
+		"the latest sync should be read back, got %+v want %+v", gotSync, wantSync)
+
+	// no temporary file is left behind
+	entries, err := ioutil.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(entries))
+}
+
+func TestFile_errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "characters")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	testutil.Ok(t, ioutil.WriteFile(corrupt, []byte("{"), 0600))
+	_, err = OpenFile(corrupt)
+	testutil.CompareError(t, "unexpected end of JSON input", err)
+
+	// the change is undone should the file not be written
+	f, err := OpenFile(filepath.Join(dir, "missing", "characters.json"))
+	testutil.Ok(t, err)
+	err = f.SaveCharacters(context.TODO(), CharacterSlice{{ID: 1, Name: "one"}})
+	testutil.CompareError(t, "no such file or directory", err)
+	_, err = f.GetCharacter(context.TODO(), 1)
+	testutil.Asserts(t, err == ErrNotFound, "the character should not be kept, got %v", err)
+}
@@ -0,0 +1,35 @@
+package characters
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Sync records a successful sync of the characters from Marvel
+type Sync struct {
+	ID             int       `db:"id"`
+	CharacterCount int       `db:"character_count"`
+	CompletedAt    time.Time `db:"completed_at"`
+}
+
+// RecordSync records a successful sync of count characters, it should be called in the
+// same transaction as the one saving the characters
+func RecordSync(ctx context.Context, db sqlx.ExecerContext, count int) error {
+	defer queryDuration.ObserveSince(time.Now(), "record_sync")
+
+	_, err := db.ExecContext(ctx, `INSERT INTO syncs (character_count) VALUES ($1)`, count)
+	return err
+}
+
+// LatestSync returns the latest successful sync, sql.ErrNoRows is returned if there has been none
+func LatestSync(ctx context.Context, db Inquirer) (Sync, error) {
+	defer queryDuration.ObserveSince(time.Now(), "latest_sync")
+
+	var s Sync
+	if err := db.GetContext(ctx, &s, `SELECT id, character_count, completed_at FROM syncs ORDER BY id DESC LIMIT 1`); err != nil {
+		return Sync{}, err
+	}
+	return s, nil
+}
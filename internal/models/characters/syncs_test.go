@@ -0,0 +1,48 @@
+package characters
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestLatestSync(t *testing.T) {
+	requireDB(t)
+
+	tests := []struct {
+		name    string
+		counts  []int
+		want    int
+		wantErr string
+	}{
+		{
+			name:    "never synced",
+			counts:  nil,
+			wantErr: sql.ErrNoRows.Error(),
+		},
+		{
+			name:   "latest of many",
+			counts: []int{1493, 1494, 1492},
+			want:   1492,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := db.MustBegin()
+			tx.MustExec(`TRUNCATE syncs`)
+			for _, c := range tt.counts {
+				testutil.Ok(t, RecordSync(context.TODO(), tx, c))
+			}
+			got, err := LatestSync(context.TODO(), tx)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want, got.CharacterCount)
+				testutil.CheckTimeApproximately(t, time.Now(), got.CompletedAt)
+			}
+			testutil.Ok(t, tx.Rollback())
+		})
+	}
+}
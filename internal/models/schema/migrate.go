@@ -0,0 +1,260 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lockID is the key of the PostgreSQL advisory lock held while migrating, so that
+// instances starting together do not run the same migration twice
+const lockID = 8305214767
+
+var migrationName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a change of the schema, with the SQL applying it and the one reverting it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads the migrations of fsys, named NNNN_name.up.sql and NNNN_name.down.sql, ordered by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		m := migrationName.FindStringSubmatch(entry.Name())
+		if m == nil || entry.IsDir() {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		sql, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(sql)
+		} else {
+			mig.Down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations, keeping the version of the DB in schema_migrations
+// the way the migrate/migrate tool does, so that it takes over DBs migrated by the latter
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator of db with the migrations of fsys, see Load
+func NewMigrator(db *sqlx.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest returns the version of the latest migration, which the code expects the DB to be at
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the version the DB is at, see Version
+func (m *Migrator) Version(ctx context.Context) (version int, dirty bool, err error) {
+	err = m.locked(ctx, func(conn *sqlx.Conn) error {
+		version, dirty, err = Version(ctx, conn)
+		return err
+	})
+	return version, dirty, err
+}
+
+// Check returns an error should the DB not be cleanly migrated to the latest migration
+func (m *Migrator) Check(ctx context.Context) error {
+	return CheckVersion(ctx, m.db, m.Latest())
+}
+
+// Up applies the pending migrations, each in its own transaction, returning how many were applied
+func (m *Migrator) Up(ctx context.Context) (applied int, err error) {
+	err = m.locked(ctx, func(conn *sqlx.Conn) error {
+		version, err := cleanVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if version > m.Latest() {
+			return fmt.Errorf("DB at migration %d, newer than the latest known %d", version, m.Latest())
+		}
+
+		for _, mig := range m.migrations {
+			if mig.Version <= version {
+				continue
+			}
+			if err = apply(ctx, conn, mig.Up, mig.Version); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps migrations applied, returning how many were reverted
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted int, err error) {
+	err = m.locked(ctx, func(conn *sqlx.Conn) error {
+		version, err := cleanVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			mig := m.migrations[i]
+			if mig.Version > version {
+				continue
+			}
+			if mig.Version < version && reverted == 0 {
+				return fmt.Errorf("DB at migration %d, which is unknown", version)
+			}
+
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down", mig.Version, mig.Name)
+			}
+			previous := 0
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			if err = apply(ctx, conn, mig.Down, previous); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Force sets the version of the DB without running any migration, and clears the dirty flag,
+// once a failed migration has been fixed by hand
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	return m.locked(ctx, func(conn *sqlx.Conn) error {
+		tx, err := conn.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err = setVersion(ctx, tx, version); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// Ensure runs the pending migrations should migrate be true, then checks that the DB is at the latest migration
+func (m *Migrator) Ensure(ctx context.Context, migrate bool) error {
+	if migrate {
+		if _, err := m.Up(ctx); err != nil {
+			return err
+		}
+	}
+	return m.Check(ctx)
+}
+
+// locked runs fn on a connection holding the migration lock, schema_migrations being created if need be
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return err
+	}
+	defer func() {
+		// the lock is released with the connection anyway, should the unlock fail
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+	}()
+
+	if _, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// cleanVersion returns the version of the DB, failing should a migration be dirty
+func cleanVersion(ctx context.Context, db Inquirer) (int, error) {
+	version, dirty, err := Version(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("migration %d is dirty, fix it by hand then force the version", version)
+	}
+	return version, nil
+}
+
+// apply runs the SQL of a migration and sets the version in the same transaction
+func apply(ctx context.Context, conn *sqlx.Conn, sql string, version int) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, sql); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = setVersion(ctx, tx, version); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// setVersion records version, 0 being no migration at all
+func setVersion(ctx context.Context, tx *sqlx.Tx, version int) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+	return err
+}
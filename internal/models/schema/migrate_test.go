@@ -0,0 +1,69 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/kagelui/marvel-forwarder/data/migrations"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []Migration
+		wantErr string
+	}{
+		{
+			name: "ordered by version",
+			fsys: fstest.MapFS{
+				"0010_scopes.up.sql":   {Data: []byte("ALTER TABLE a ADD b INT;")},
+				"0010_scopes.down.sql": {Data: []byte("ALTER TABLE a DROP b;")},
+				"0002_init.up.sql":     {Data: []byte("CREATE TABLE a (id INT);")},
+				"0002_init.down.sql":   {Data: []byte("DROP TABLE a;")},
+				"migrations.go":        {Data: []byte("package migrations")},
+			},
+			want: []Migration{
+				{Version: 2, Name: "init", Up: "CREATE TABLE a (id INT);", Down: "DROP TABLE a;"},
+				{Version: 10, Name: "scopes", Up: "ALTER TABLE a ADD b INT;", Down: "ALTER TABLE a DROP b;"},
+			},
+		},
+		{
+			name:    "no up",
+			fsys:    fstest.MapFS{"0001_init.down.sql": {Data: []byte("DROP TABLE a;")}},
+			wantErr: "migration 1 has no up",
+		},
+		{
+			name: "two names",
+			fsys: fstest.MapFS{
+				"0001_init.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+				"0001_create.up.sql": {Data: []byte("CREATE TABLE b (id INT);")},
+				"0001_init.down.sql": {Data: []byte("DROP TABLE a;")},
+			},
+			wantErr: "migration 1 is named both",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.fsys)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoad_embedded(t *testing.T) {
+	got, err := Load(migrations.FS)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, len(got) > 0, "migrations should be embedded")
+	for i, m := range got {
+		testutil.Equals(t, i+1, m.Version)
+		testutil.Asserts(t, m.Down != "", "migration %d should have a down", m.Version)
+	}
+
+	m := &Migrator{migrations: got}
+	testutil.Equals(t, got[len(got)-1].Version, m.Latest())
+}
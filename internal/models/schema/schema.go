@@ -0,0 +1,45 @@
+// Package schema runs the migrations of data/migrations and tells which one the DB is at
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Inquirer is implemented by *sqlx.DB and *sqlx.Tx
+type Inquirer interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// Version returns the version the DB is migrated to, dirty being true should a migration have
+// failed half way. It is 0 should no migration have been run
+func Version(ctx context.Context, db Inquirer) (version int, dirty bool, err error) {
+	var row struct {
+		Version int  `db:"version"`
+		Dirty   bool `db:"dirty"`
+	}
+	err = db.GetContext(ctx, &row, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return row.Version, row.Dirty, nil
+}
+
+// CheckVersion returns an error should the DB not be cleanly migrated to the expected version
+func CheckVersion(ctx context.Context, db Inquirer, expected int) error {
+	version, dirty, err := Version(ctx, db)
+	switch {
+	case err != nil:
+		return err
+	case dirty:
+		return fmt.Errorf("migration %d is dirty", version)
+	case version != expected:
+		return fmt.Errorf("at migration %d, expected %d", version, expected)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+type mockInquirer struct {
+	version int
+	dirty   bool
+	err     error
+}
+
+func (m mockInquirer) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if m.err != nil {
+		return m.err
+	}
+	row := reflect.ValueOf(dest).Elem()
+	row.Field(0).SetInt(int64(m.version))
+	row.Field(1).SetBool(m.dirty)
+	return nil
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		db      mockInquirer
+		wantErr string
+	}{
+		{name: "expected", db: mockInquirer{version: 4}},
+		{name: "behind", db: mockInquirer{version: 3}, wantErr: "at migration 3, expected 4"},
+		{name: "dirty", db: mockInquirer{version: 4, dirty: true}, wantErr: "migration 4 is dirty"},
+		{name: "never migrated", db: mockInquirer{err: sql.ErrNoRows}, wantErr: "at migration 0, expected 4"},
+		{name: "db error", db: mockInquirer{err: errors.New("db down")}, wantErr: "db down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.CompareError(t, tt.wantErr, CheckVersion(context.TODO(), tt.db, 4))
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Package database connects to PostgreSQL and routes the reads to its replicas
+package database
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Pool is the config of a connection pool, read with envvar
+type Pool struct {
+	MaxOpenConns int `env:"MAX_OPEN_CONNS,default=10,min=1"`
+	// MaxIdleConns is capped at MaxOpenConns by database/sql
+	MaxIdleConns    int           `env:"MAX_IDLE_CONNS,default=5,min=0"`
+	ConnMaxLifetime time.Duration `env:"CONN_MAX_LIFETIME,default=30m"`
+	ConnMaxIdleTime time.Duration `env:"CONN_MAX_IDLE_TIME,default=5m"`
+}
+
+// Apply sets the pool of db
+func (p Pool) Apply(db *sqlx.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+// Connect connects to the PostgreSQL at addr with the pool
+func Connect(addr string, pool Pool) (*sqlx.DB, error) {
+	db, err := sqlx.Connect("postgres", addr)
+	if err != nil {
+		return nil, err
+	}
+	pool.Apply(db)
+	return db, nil
+}
+
+// Open returns a DB for the PostgreSQL at addr with the pool, without connecting to it yet,
+// e.g. for a replica which may be down when starting
+func Open(addr string, pool Pool) (*sqlx.DB, error) {
+	db, err := sqlx.Open("postgres", addr)
+	if err != nil {
+		return nil, err
+	}
+	pool.Apply(db)
+	return db, nil
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/metrics"
+)
+
+var (
+	readsTotal = metrics.NewCounter("db_reads_total",
+		"Reads routed by the replica router, per target (replica, primary or fallback to the primary after a replica failed).", "target")
+	replicaHealthy = metrics.NewGauge("db_replica_healthy",
+		"Whether the replica is read from, 1, or not, 0, per replica.", "replica")
+)
+
+// lagQuery is whether the replica is streaming from the primary, and how far behind it the replica is,
+// in seconds, 0 when it has replayed all it received. Having replayed all it received says nothing
+// of a replica cut off from the primary, hence the WAL receiver, which has no row when disconnected,
+// its status being hidden from the roles without pg_read_all_stats
+const lagQuery = `SELECT
+	EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming') AS streaming,
+	COALESCE(CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) END, 0) AS lag`
+
+// errNotStreaming is returned by replicationLag for a replica not receiving the WAL of the primary
+var errNotStreaming = errors.New("not streaming from the primary")
+
+// RouterOptions of a Router, read with envvar
+type RouterOptions struct {
+	// MaxLag is how far behind the primary a replica may be to be read from
+	MaxLag        time.Duration `env:"MAX_LAG,default=30s"`
+	CheckInterval time.Duration `env:"CHECK_INTERVAL,default=5s,min=1s"`
+	CheckTimeout  time.Duration `env:"CHECK_TIMEOUT,default=2s,min=1ms"`
+}
+
+// Router routes the reads to the healthy replicas in turn, or to the primary should there be none.
+// The replicas are checked every CheckInterval, and a replica failing a read is not read from
+// again until it passes a check
+type Router struct {
+	primary  *sqlx.DB
+	replicas []*replica
+	opts     RouterOptions
+	lag      func(ctx context.Context, db *sqlx.DB) (time.Duration, error)
+	next     uint32
+}
+
+type replica struct {
+	name    string
+	db      *sqlx.DB
+	healthy int32
+}
+
+// NewRouter returns a Router whose replicas are not read from until checked, see CheckAll and Run
+func NewRouter(primary *sqlx.DB, replicas []*sqlx.DB, opts RouterOptions) *Router {
+	r := &Router{primary: primary, opts: opts, lag: replicationLag}
+	for i, db := range replicas {
+		r.replicas = append(r.replicas, &replica{name: fmt.Sprintf("replica%d", i), db: db})
+	}
+	return r
+}
+
+// Primary is where the writes go
+func (r *Router) Primary() *sqlx.DB {
+	return r.primary
+}
+
+// primaryContextKey marks the contexts of the reads to send to the primary
+type primaryContextKey struct{}
+
+// WithPrimary returns a copy of ctx whose reads go to the primary, e.g. when they must see
+// what was just committed, which the replicas may not have replayed yet
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// PrimaryFromContext returns whether the reads with ctx go to the primary, see WithPrimary
+func PrimaryFromContext(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryContextKey{}).(bool)
+	return primary
+}
+
+// Read runs fn against a healthy replica, then against the primary should it fail with
+// anything but sql.ErrNoRows, or against the primary right away should there be no healthy
+// replica or ctx be WithPrimary
+func (r *Router) Read(ctx context.Context, fn func(db *sqlx.DB) error) error {
+	rep := r.pickFor(ctx)
+	if rep == nil {
+		readsTotal.Inc("primary")
+		return fn(r.primary)
+	}
+
+	readsTotal.Inc("replica")
+	err := fn(rep.db)
+	if err == nil || errors.Is(err, sql.ErrNoRows) || ctx.Err() != nil {
+		return err
+	}
+
+	loglib.GetLogger(ctx).ErrorF("[DB router] %s failed a read, reading from the primary until it passes a check: %s", rep.name, err)
+	r.setHealthy(rep, false)
+	readsTotal.Inc("fallback")
+	return fn(r.primary)
+}
+
+// ReadOnce runs fn against a healthy replica, or against the primary should there be none or ctx be
+// WithPrimary, with no fall back on failure, e.g. for fn streaming rows to a client who would otherwise
+// get some of them twice
+func (r *Router) ReadOnce(ctx context.Context, fn func(db *sqlx.DB) error) error {
+	rep := r.pickFor(ctx)
+	if rep == nil {
+		readsTotal.Inc("primary")
+		return fn(r.primary)
+	}
+	readsTotal.Inc("replica")
+	return fn(rep.db)
+}
+
+// pickFor returns the replica to read from with ctx, nil for the primary
+func (r *Router) pickFor(ctx context.Context) *replica {
+	if PrimaryFromContext(ctx) {
+		return nil
+	}
+	return r.pick()
+}
+
+// pick returns the next healthy replica, nil if there is none
+func (r *Router) pick() *replica {
+	n := len(r.replicas)
+	if n == 0 {
+		return nil
+	}
+	start := int(atomic.AddUint32(&r.next, 1))
+	for i := 0; i < n; i++ {
+		rep := r.replicas[(start+i)%n]
+		if atomic.LoadInt32(&rep.healthy) == 1 {
+			return rep
+		}
+	}
+	return nil
+}
+
+// CheckAll checks every replica, marking those not answering or lagging more than MaxLag unhealthy
+func (r *Router) CheckAll(ctx context.Context) {
+	lg := loglib.GetLogger(ctx)
+	for _, rep := range r.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, r.opts.CheckTimeout)
+		lag, err := r.lag(checkCtx, rep.db)
+		cancel()
+
+		healthy := err == nil && lag <= r.opts.MaxLag
+		if healthy != (atomic.LoadInt32(&rep.healthy) == 1) {
+			switch {
+			case err != nil:
+				lg.ErrorF("[DB router] %s unhealthy: %s", rep.name, err)
+			case !healthy:
+				lg.ErrorF("[DB router] %s unhealthy: %s behind the primary, more than %s", rep.name, lag.Round(time.Millisecond), r.opts.MaxLag)
+			default:
+				lg.InfoF("[DB router] %s healthy", rep.name)
+			}
+		}
+		r.setHealthy(rep, healthy)
+	}
+}
+
+// Run checks the replicas every CheckInterval until ctx is done
+func (r *Router) Run(ctx context.Context) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(r.opts.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.CheckAll(ctx)
+		}
+	}
+}
+
+func (r *Router) setHealthy(rep *replica, healthy bool) {
+	v := int32(0)
+	if healthy {
+		v = 1
+	}
+	atomic.StoreInt32(&rep.healthy, v)
+	replicaHealthy.Set(float64(v), rep.name)
+}
+
+// replicationLag asks the replica how far behind the primary it is, errNotStreaming being
+// returned should it not be receiving from the primary
+func replicationLag(ctx context.Context, db *sqlx.DB) (time.Duration, error) {
+	var status struct {
+		Streaming bool    `db:"streaming"`
+		Lag       float64 `db:"lag"`
+	}
+	if err := db.GetContext(ctx, &status, lagQuery); err != nil {
+		return 0, err
+	}
+	if !status.Streaming {
+		return 0, errNotStreaming
+	}
+	return time.Duration(status.Lag * float64(time.Second)), nil
+}
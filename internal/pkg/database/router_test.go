@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+	_ "github.com/lib/pq"
+)
+
+// newDB returns a DB which is never connected to, only telling apart where a read went
+func newDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("postgres", "postgres://localhost/none")
+	testutil.Ok(t, err)
+	return db
+}
+
+func TestRouter_Read(t *testing.T) {
+	primary, replica0, replica1 := newDB(t), newDB(t), newDB(t)
+	names := map[*sqlx.DB]string{primary: "primary", replica0: "replica0", replica1: "replica1"}
+
+	tests := []struct {
+		name     string
+		replicas []*sqlx.DB
+		lags     map[*sqlx.DB]time.Duration
+		failing  map[*sqlx.DB]error
+		primary  bool
+		want     []string
+		wantErr  string
+	}{
+		{
+			name: "no replica",
+			want: []string{"primary"},
+		},
+		{
+			name:     "replicas in turn",
+			replicas: []*sqlx.DB{replica0, replica1},
+			want:     []string{"replica1", "replica0", "replica1"},
+		},
+		{
+			name:     "lagging replica skipped",
+			replicas: []*sqlx.DB{replica0, replica1},
+			lags:     map[*sqlx.DB]time.Duration{replica1: time.Minute},
+			want:     []string{"replica0", "replica0"},
+		},
+		{
+			name:     "every replica lagging",
+			replicas: []*sqlx.DB{replica0},
+			lags:     map[*sqlx.DB]time.Duration{replica0: time.Minute},
+			want:     []string{"primary"},
+		},
+		{
+			name:     "failing replica falls back to the primary, then is skipped",
+			replicas: []*sqlx.DB{replica0, replica1},
+			failing:  map[*sqlx.DB]error{replica1: errors.New("connection refused")},
+			want:     []string{"replica1", "primary", "replica0", "replica0"},
+		},
+		{
+			name:     "primary asked for",
+			replicas: []*sqlx.DB{replica0, replica1},
+			primary:  true,
+			want:     []string{"primary", "primary"},
+		},
+		{
+			name:     "no rows is not a failure",
+			replicas: []*sqlx.DB{replica0},
+			failing:  map[*sqlx.DB]error{replica0: sql.ErrNoRows},
+			want:     []string{"replica0", "replica0"},
+			wantErr:  sql.ErrNoRows.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter(primary, tt.replicas, RouterOptions{MaxLag: 30 * time.Second, CheckTimeout: time.Second})
+			r.lag = func(ctx context.Context, db *sqlx.DB) (time.Duration, error) {
+				return tt.lags[db], nil
+			}
+			r.CheckAll(context.TODO())
+
+			ctx := context.TODO()
+			if tt.primary {
+				ctx = WithPrimary(ctx)
+			}
+			var got []string
+			var err error
+			for len(got) < len(tt.want) {
+				err = r.Read(ctx, func(db *sqlx.DB) error {
+					got = append(got, names[db])
+					return tt.failing[db]
+				})
+			}
+			testutil.CompareError(t, tt.wantErr, err)
+			testutil.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestRouter_ReadOnce(t *testing.T) {
+	primary, replica0 := newDB(t), newDB(t)
+	names := map[*sqlx.DB]string{primary: "primary", replica0: "replica0"}
+
+	r := NewRouter(primary, []*sqlx.DB{replica0}, RouterOptions{MaxLag: 30 * time.Second, CheckTimeout: time.Second})
+	r.lag = func(ctx context.Context, db *sqlx.DB) (time.Duration, error) { return 0, nil }
+	r.CheckAll(context.TODO())
+
+	// a failure is returned as is, neither falling back to the primary nor marking the replica unhealthy
+	var got []string
+	for i := 0; i < 2; i++ {
+		err := r.ReadOnce(context.TODO(), func(db *sqlx.DB) error {
+			got = append(got, names[db])
+			return errors.New("client gone")
+		})
+		testutil.CompareError(t, "client gone", err)
+	}
+	testutil.Equals(t, []string{"replica0", "replica0"}, got)
+
+	// the primary is used when no replica is healthy
+	r.setHealthy(r.replicas[0], false)
+	got = nil
+	testutil.Ok(t, r.ReadOnce(context.TODO(), func(db *sqlx.DB) error {
+		got = append(got, names[db])
+		return nil
+	}))
+	testutil.Equals(t, []string{"primary"}, got)
+}
+
+func TestRouter_CheckAll(t *testing.T) {
+	primary, replica := newDB(t), newDB(t)
+	r := NewRouter(primary, []*sqlx.DB{replica}, RouterOptions{MaxLag: time.Second, CheckTimeout: time.Second})
+
+	var lagErr error
+	r.lag = func(ctx context.Context, db *sqlx.DB) (time.Duration, error) {
+		return 0, lagErr
+	}
+	read := func() *sqlx.DB {
+		var got *sqlx.DB
+		testutil.Ok(t, r.Read(context.TODO(), func(db *sqlx.DB) error {
+			got = db
+			return nil
+		}))
+		return got
+	}
+
+	testutil.Asserts(t, read() == primary, "the replica should not be read from before being checked")
+	r.CheckAll(context.TODO())
+	testutil.Asserts(t, read() == replica, "the checked replica should be read from")
+
+	lagErr = errors.New("timeout")
+	r.CheckAll(context.TODO())
+	testutil.Asserts(t, read() == primary, "the replica failing its check should not be read from")
+
+	lagErr = nil
+	r.CheckAll(context.TODO())
+	testutil.Asserts(t, read() == replica, "the replica should be read from again once it passes a check")
+}
+
+func TestReplicationLag_notReplica(t *testing.T) {
+	addr, ok := os.LookupEnv("DATABASE_URL")
+	if !ok {
+		t.Skip("DATABASE_URL not set")
+	}
+	db, err := sqlx.Connect("postgres", addr)
+	testutil.Ok(t, err)
+	defer db.Close()
+
+	// the primary streams from no one, like a replica cut off from it
+	_, err = replicationLag(context.TODO(), db)
+	testutil.Equals(t, errNotStreaming, err)
+}
@@ -0,0 +1,84 @@
+package envvar
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// mask replaces the values of the secret fields
+const mask = "******"
+
+// Format lists the KEY=value of the fields of the target read by Read, one per line,
+// masking the fields tagged secret so that the config can be logged
+func Format(target interface{}) string {
+	v := reflect.Indirect(reflect.ValueOf(target))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	var lines []string
+	formatStruct(v, "", &lines)
+	return strings.Join(lines, "\n")
+}
+
+func formatStruct(v reflect.Value, prefix string, lines *[]string) {
+	refType := v.Type()
+	for i := 0; i < refType.NumField(); i++ {
+		t, err := parseTag(refType.Field(i))
+		if err != nil || t.key == "-" || !v.Field(i).CanInterface() {
+			continue
+		}
+
+		if isNested(refType.Field(i).Type) {
+			nestedPrefix := prefix
+			if t.key != "" {
+				nestedPrefix += t.key + "_"
+			}
+			formatStruct(v.Field(i), nestedPrefix, lines)
+			continue
+		}
+
+		value := formatValue(v.Field(i))
+		if t.secret && value != "" {
+			value = mask
+		}
+		*lines = append(*lines, prefix+t.key+"="+value)
+	}
+}
+
+// formatValue formats the value the way it is read
+func formatValue(v reflect.Value) string {
+	if v.CanAddr() && v.Addr().Type().Implements(decoderType) {
+		if s, ok := v.Addr().Interface().(fmt.Stringer); ok {
+			return s.String()
+		}
+	}
+	if u, ok := v.Interface().(url.URL); ok {
+		return u.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return ""
+		}
+		return formatValue(v.Elem())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		pairs := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			pairs = append(pairs, formatValue(iter.Key())+":"+formatValue(iter.Value()))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,44 @@
+package envvar
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestFormat(t *testing.T) {
+	type db struct {
+		URL string `env:"URL,secret"`
+	}
+	target := struct {
+		AppName  string            `env:"APPNAME"`
+		Key      string            `env:"PRIVATE_KEY,secret"`
+		Unset    string            `env:"ADMIN_TOKEN,optional,secret"`
+		TTL      time.Duration     `env:"CACHE_TTL"`
+		Tokens   []string          `env:"TOKENS"`
+		Labels   map[string]string `env:"LABELS"`
+		Endpoint *url.URL          `env:"ENDPOINT"`
+		Skipped  string            `env:"-"`
+		DB       db                `env:"DB"`
+	}{
+		AppName:  "api",
+		Key:      "s3cret",
+		TTL:      10 * time.Minute,
+		Tokens:   []string{"a", "b"},
+		Labels:   map[string]string{"tier": "1", "team": "api"},
+		Endpoint: &url.URL{Scheme: "https", Host: "example.com"},
+		Skipped:  "x",
+		DB:       db{URL: "postgres://user:pass@db"},
+	}
+
+	testutil.Equals(t, `APPNAME=api
+PRIVATE_KEY=******
+ADMIN_TOKEN=
+CACHE_TTL=10m0s
+TOKENS=a,b
+LABELS=team:api,tier:1
+ENDPOINT=https://example.com
+DB_URL=******`, Format(&target))
+}
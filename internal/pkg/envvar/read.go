@@ -2,7 +2,7 @@ package envvar
 
 import (
 	"fmt"
-	"os"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
@@ -11,8 +11,39 @@ import (
 
 const tagName = "env"
 
-// Read fills the target with the env var
+// Decoder is implemented by the types parsing their own env var
+type Decoder interface {
+	UnmarshalEnv(value string) error
+}
+
+var (
+	decoderType  = reflect.TypeOf((*Decoder)(nil)).Elem()
+	durationType = reflect.TypeOf(time.Nanosecond)
+	urlType      = reflect.TypeOf(url.URL{})
+)
+
+// Errors is every missing or invalid env var found by Read
+type Errors []error
+
+// Error lists the errors, separated by semicolons
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Read fills the target with the env var from Default, see ReadFrom
 func Read(target interface{}) error {
+	return ReadFrom(Default, target)
+}
+
+// ReadFrom fills the target with the env var from src, see parseTag for the options of the tags.
+// The fields of a nested struct are read with the key of the struct and an underscore as prefix,
+// e.g. `env:"DB"` on a struct with `env:"URL"` reads DB_URL.
+// Missing or invalid env vars are returned together as Errors
+func ReadFrom(src Source, target interface{}) error {
 	rv := reflect.ValueOf(target)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return fmt.Errorf("invalid type %v passed", reflect.TypeOf(target))
@@ -23,72 +54,195 @@ func Read(target interface{}) error {
 		return fmt.Errorf("not a struct pointer")
 	}
 
+	var errs Errors
+	if err := readStruct(src, v, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// readStruct fills the struct, adding the missing or invalid env vars to errs.
+// The returned error is a malformed tag
+func readStruct(src Source, v reflect.Value, prefix string, errs *Errors) error {
 	refType := v.Type()
 
-	envVarKeys := make([]string, refType.NumField())
+	tags := make([]tag, refType.NumField())
 
 	for i := 0; i < refType.NumField(); i++ {
-		refTypeField := refType.Field(i)
-		envVarKey, ok := refTypeField.Tag.Lookup(tagName)
-		if !ok {
-			return fmt.Errorf("env tag not set for field %s", refTypeField.Name)
+		t, err := parseTag(refType.Field(i))
+		if err != nil {
+			return err
 		}
-		envVarKeys[i] = envVarKey
+		tags[i] = t
 	}
 
-	for i, key := range envVarKeys {
-		if key == "-" {
+	for i, t := range tags {
+		if t.key == "-" {
 			continue
 		}
 
-		value, ok := os.LookupEnv(key)
-		if !ok {
-			return fmt.Errorf("%s not present", key)
-		}
-		value = strings.TrimSpace(value)
-
 		fieldValue := v.Field(i)
 		if !fieldValue.IsValid() || !fieldValue.CanSet() {
-			return fmt.Errorf("field %s is not valid or cannot be set", refType.Field(i).Name)
+			*errs = append(*errs, fmt.Errorf("field %s is not valid or cannot be set", refType.Field(i).Name))
+			continue
 		}
 
-		// try parsing the "type" first
-		fieldType := refType.Field(i)
-		switch fieldType.Type {
-		case reflect.TypeOf(time.Nanosecond):
-			t, err := time.ParseDuration(value)
-			if err != nil {
+		if isNested(fieldValue.Type()) {
+			nestedPrefix := prefix
+			if t.key != "" {
+				nestedPrefix += t.key + "_"
+			}
+			if err := readStruct(src, fieldValue, nestedPrefix, errs); err != nil {
 				return err
 			}
-			fieldValue.Set(reflect.ValueOf(t))
 			continue
 		}
 
-		// then try the built-in "kinds"
-		switch fieldValue.Kind() {
-		case reflect.String:
-			fieldValue.SetString(value)
-		case reflect.Int:
-			num, err := strconv.Atoi(value)
-			if err != nil {
+		key := prefix + t.key
+
+		value, _, err := src.Lookup(key)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: %v", key, err))
+			continue
+		}
+		// an empty env var is as good as a missing one
+		value = strings.TrimSpace(value)
+		if value == "" {
+			if t.def == nil {
+				if !t.optional {
+					*errs = append(*errs, fmt.Errorf("%s not present", key))
+				}
+				continue
+			}
+			value = *t.def
+		}
+
+		if err := setValue(fieldValue, value); err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: %v", key, err))
+			continue
+		}
+		if err := t.validate(fieldValue, value); err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: %v", key, err))
+		}
+	}
+	return nil
+}
+
+// isNested is whether the fields of the struct are read, rather than the struct itself
+func isNested(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct && typ != urlType && !reflect.PtrTo(typ).Implements(decoderType)
+}
+
+// setValue parses the value into the field.
+// Slices are comma separated, and maps are comma separated key:value pairs
+func setValue(fieldValue reflect.Value, value string) error {
+	// try the Decoder and parsing the "type" first
+	if fieldValue.CanAddr() && fieldValue.Addr().Type().Implements(decoderType) {
+		return fieldValue.Addr().Interface().(Decoder).UnmarshalEnv(value)
+	}
+	switch fieldValue.Type() {
+	case durationType:
+		t, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fieldValue.Set(reflect.ValueOf(t))
+		return nil
+	case urlType:
+		u, err := url.Parse(value)
+		if err != nil {
+			return err
+		}
+		fieldValue.Set(reflect.ValueOf(*u))
+		return nil
+	}
+
+	// then try the built-in "kinds"
+	switch fieldValue.Kind() {
+	case reflect.String:
+		fieldValue.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fieldValue.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		num, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if fieldValue.OverflowInt(num) {
+			return fmt.Errorf("%s %d overflows", fieldValue.Type(), num)
+		}
+		fieldValue.SetInt(num)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		num, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if fieldValue.OverflowUint(num) {
+			return fmt.Errorf("%s %d overflows", fieldValue.Type(), num)
+		}
+		fieldValue.SetUint(num)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		if fieldValue.OverflowFloat(f) {
+			return fmt.Errorf("%s %v overflows", fieldValue.Type(), f)
+		}
+		fieldValue.SetFloat(f)
+	case reflect.Ptr:
+		elem := reflect.New(fieldValue.Type().Elem())
+		if err := setValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		fieldValue.Set(elem)
+	case reflect.Slice:
+		items := splitList(value)
+		slice := reflect.MakeSlice(fieldValue.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), item); err != nil {
 				return err
 			}
-			if fieldValue.OverflowInt(int64(num)) {
-				return fmt.Errorf("int %d overflows for field %s", num, refType.Field(i).Name)
+		}
+		fieldValue.Set(slice)
+	case reflect.Map:
+		m := reflect.MakeMap(fieldValue.Type())
+		for _, pair := range splitList(value) {
+			kv := strings.SplitN(pair, ":", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("%q is not a key:value pair", pair)
 			}
-			fieldValue.SetInt(int64(num))
-		case reflect.Float64:
-			f, err := strconv.ParseFloat(value, 64)
-			if err != nil {
+			k := reflect.New(fieldValue.Type().Key()).Elem()
+			if err := setValue(k, strings.TrimSpace(kv[0])); err != nil {
 				return err
 			}
-			if fieldValue.OverflowFloat(f) {
-				return fmt.Errorf("float64 %v overflows for field %s", f, refType.Field(i).Name)
+			e := reflect.New(fieldValue.Type().Elem()).Elem()
+			if err := setValue(e, strings.TrimSpace(kv[1])); err != nil {
+				return err
 			}
-			fieldValue.SetFloat(f)
-		default:
-			return fmt.Errorf("unsupported type %s", fieldValue.Type().Name())
+			m.SetMapIndex(k, e)
 		}
+		fieldValue.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", fieldValue.Type())
 	}
 	return nil
 }
+
+// splitList splits the comma separated value, dropping the empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,7 +1,10 @@
 package envvar
 
 import (
+	"fmt"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -158,6 +161,81 @@ func TestRead(t *testing.T) {
 			}{One: "hey", Two: "", Three: 319826, Four: "", Five: 861.8362, Six: time.Second * 5},
 			wantErr: "",
 		},
+		{
+			name: "defaults and optional",
+			target: &struct {
+				One   string        `env:"one,default=public,max-age=60"`
+				Two   int           `env:"two,default=8080"`
+				Three time.Duration `env:"three,optional"`
+				Four  float64       `env:"four,default=0.5"`
+			}{},
+			envVar: map[string]string{"four": "1", "three": " "},
+			want: &struct {
+				One   string        `env:"one,default=public,max-age=60"`
+				Two   int           `env:"two,default=8080"`
+				Three time.Duration `env:"three,optional"`
+				Four  float64       `env:"four,default=0.5"`
+			}{One: "public,max-age=60", Two: 8080, Four: 1},
+			wantErr: "",
+		},
+		{
+			name: "every error at once",
+			target: &struct {
+				One   string  `env:"one"`
+				Two   int     `env:"two,min=1,max=10"`
+				Three string  `env:"three,oneof=debug info"`
+				Four  string  `env:"four,url"`
+				Five  float64 `env:"five"`
+				Six   string  `env:"six,default=x,min=2"`
+			}{},
+			envVar:  map[string]string{"two": "11", "three": "trace", "four": "localhost:8080", "five": "half"},
+			want:    nil,
+			wantErr: `one not present; two: must be at most 10; three: must be one of debug, info; four: must be an absolute URL; five: strconv.ParseFloat: parsing "half": invalid syntax; six: must be at least 2 characters`,
+		},
+		{
+			name: "valid values",
+			target: &struct {
+				Two   int           `env:"two,min=1,max=10"`
+				Three string        `env:"three,oneof=debug info"`
+				Four  string        `env:"four,url"`
+				Five  time.Duration `env:"five,min=1s"`
+			}{},
+			envVar: map[string]string{"two": "10", "three": "info", "four": "http://localhost:8080/path", "five": "1m"},
+			want: &struct {
+				Two   int           `env:"two,min=1,max=10"`
+				Three string        `env:"three,oneof=debug info"`
+				Four  string        `env:"four,url"`
+				Five  time.Duration `env:"five,min=1s"`
+			}{Two: 10, Three: "info", Four: "http://localhost:8080/path", Five: time.Minute},
+			wantErr: "",
+		},
+		{
+			name: "unknown option",
+			target: &struct {
+				One string `env:"one,required"`
+			}{},
+			envVar:  map[string]string{"one": "hey"},
+			want:    nil,
+			wantErr: `unknown option "required" for field One`,
+		},
+		{
+			name: "malformed option",
+			target: &struct {
+				One time.Duration `env:"one,min=5"`
+			}{},
+			envVar:  map[string]string{"one": "5s"},
+			want:    nil,
+			wantErr: `malformed option "min=5" for field One: time: missing unit in duration "5"`,
+		},
+		{
+			name: "option without value",
+			target: &struct {
+				One string `env:"one,default"`
+			}{},
+			envVar:  map[string]string{"one": "hey"},
+			want:    nil,
+			wantErr: `malformed option "default" for field One`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -177,3 +255,126 @@ func TestRead(t *testing.T) {
 		})
 	}
 }
+
+// level is a Decoder
+type level int
+
+func (l *level) UnmarshalEnv(value string) error {
+	switch strings.ToLower(value) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level %s", value)
+	}
+	return nil
+}
+
+type dbConfig struct {
+	URL      string `env:"URL"`
+	MaxConns uint   `env:"MAX_CONNS,default=10"`
+}
+
+type config struct {
+	Enabled  bool              `env:"ENABLED"`
+	Offset   int64             `env:"OFFSET"`
+	Keys     []string          `env:"KEYS,min=1"`
+	Ports    []int             `env:"PORTS,optional"`
+	Labels   map[string]string `env:"LABELS,optional"`
+	Endpoint *url.URL          `env:"ENDPOINT"`
+	Level    level             `env:"LEVEL"`
+	Priority *level            `env:"PRIORITY,optional"`
+	Primary  dbConfig          `env:"DB"`
+	Replica  dbConfig          `env:"REPLICA_DB"`
+	Shared   struct {
+		Name string `env:"APPNAME"`
+	} `env:""`
+}
+
+func TestRead_types(t *testing.T) {
+	tests := []struct {
+		name    string
+		envVar  map[string]string
+		want    func() config
+		wantErr string
+	}{
+		{
+			name: "everything set",
+			envVar: map[string]string{
+				"ENABLED": "true", "OFFSET": "-9000000000", "KEYS": "new, old,", "PORTS": "80,443",
+				"LABELS": "team:api, tier: 1", "ENDPOINT": "https://example.com/x", "LEVEL": "High", "PRIORITY": "low",
+				"DB_URL": "postgres://db", "DB_MAX_CONNS": "20", "REPLICA_DB_URL": "postgres://replica", "APPNAME": "api",
+			},
+			want: func() config {
+				priority := level(1)
+				c := config{
+					Enabled:  true,
+					Offset:   -9000000000,
+					Keys:     []string{"new", "old"},
+					Ports:    []int{80, 443},
+					Labels:   map[string]string{"team": "api", "tier": "1"},
+					Endpoint: &url.URL{Scheme: "https", Host: "example.com", Path: "/x"},
+					Level:    2,
+					Priority: &priority,
+					Primary:  dbConfig{URL: "postgres://db", MaxConns: 20},
+					Replica:  dbConfig{URL: "postgres://replica", MaxConns: 10},
+				}
+				c.Shared.Name = "api"
+				return c
+			},
+		},
+		{
+			name: "every error at once",
+			envVar: map[string]string{
+				"ENABLED": "yes", "OFFSET": "1", "KEYS": ",", "PORTS": "80,http", "LABELS": "team",
+				"ENDPOINT": "https://example.com", "LEVEL": "medium", "DB_URL": "postgres://db", "DB_MAX_CONNS": "-1",
+				"APPNAME": "api",
+			},
+			wantErr: `ENABLED: strconv.ParseBool: parsing "yes": invalid syntax; KEYS: must be at least 1 items; ` +
+				`PORTS: strconv.ParseInt: parsing "http": invalid syntax; LABELS: "team" is not a key:value pair; ` +
+				`LEVEL: unknown level medium; DB_MAX_CONNS: strconv.ParseUint: parsing "-1": invalid syntax; REPLICA_DB_URL not present`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.envVar {
+				testutil.Ok(t, os.Setenv(k, v))
+			}
+
+			var got config
+			err := Read(&got)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want(), got)
+			}
+
+			for k := range tt.envVar {
+				testutil.Ok(t, os.Unsetenv(k))
+			}
+		})
+	}
+}
+
+func TestRead_overflow(t *testing.T) {
+	testutil.Ok(t, os.Setenv("small", "300"))
+	defer os.Unsetenv("small")
+
+	var target struct {
+		Small uint8 `env:"small"`
+	}
+	testutil.CompareError(t, "small: uint8 300 overflows", Read(&target))
+}
+
+func TestRead_sliceRules(t *testing.T) {
+	testutil.Ok(t, os.Setenv("hosts", "http://a.com,b.com"))
+	testutil.Ok(t, os.Setenv("modes", "read,write,admin"))
+	defer os.Unsetenv("hosts")
+	defer os.Unsetenv("modes")
+
+	var target struct {
+		Hosts []string `env:"hosts,url"`
+		Modes []string `env:"modes,oneof=read write,max=3"`
+	}
+	testutil.CompareError(t, "hosts: must be an absolute URL; modes: must be one of read, write", Read(&target))
+}
@@ -0,0 +1,129 @@
+package envvar
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FileSuffix is the suffix of the env vars holding the path of a file with the value, e.g. PRIVATE_KEY_FILE
+const FileSuffix = "_FILE"
+
+// Source is where the values of the env vars are looked up
+type Source interface {
+	// Lookup returns the value of the key, ok is false if the source doesn't have it
+	Lookup(key string) (value string, ok bool, err error)
+}
+
+// SourceFunc is a func used as a Source
+type SourceFunc func(key string) (string, bool, error)
+
+// Lookup calls f
+func (f SourceFunc) Lookup(key string) (string, bool, error) {
+	return f(key)
+}
+
+// Default is the Source of Read: the env vars, then the files of the _FILE env vars
+var Default = Chain(Env(), Files(Env()))
+
+// Env looks up the env vars of the process
+func Env() Source {
+	return SourceFunc(func(key string) (string, bool, error) {
+		value, ok := os.LookupEnv(key)
+		return value, ok, nil
+	})
+}
+
+// Files looks up the key with FileSuffix in src and reads the file it names,
+// without the trailing newline, as mounted secrets usually end with one
+func Files(src Source) Source {
+	return SourceFunc(func(key string) (string, bool, error) {
+		path, ok, err := src.Lookup(key + FileSuffix)
+		if err != nil || !ok || strings.TrimSpace(path) == "" {
+			return "", false, err
+		}
+		b, err := ioutil.ReadFile(strings.TrimSpace(path))
+		if err != nil {
+			return "", false, fmt.Errorf("reading %s%s: %v", key, FileSuffix, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), true, nil
+	})
+}
+
+// Map looks up the keys of m
+func Map(m map[string]string) Source {
+	return SourceFunc(func(key string) (string, bool, error) {
+		value, ok := m[key]
+		return value, ok, nil
+	})
+}
+
+// Chain looks up the sources in order, the first one with a non empty value wins
+func Chain(sources ...Source) Source {
+	return SourceFunc(func(key string) (string, bool, error) {
+		for _, src := range sources {
+			value, ok, err := src.Lookup(key)
+			if err != nil {
+				return "", false, err
+			}
+			if ok && strings.TrimSpace(value) != "" {
+				return value, true, nil
+			}
+		}
+		return "", false, nil
+	})
+}
+
+// Dotenv reads a .env file of KEY=VALUE lines, where blank lines and lines starting with # are skipped,
+// an export prefix is allowed and values may be quoted
+func Dotenv(path string) (Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" {
+			return nil, fmt.Errorf("%s:%d: not a KEY=VALUE line", path, n)
+		}
+		value := strings.TrimSpace(kv[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				if value, err = strconv.Unquote(value); err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+				}
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		m[key] = value
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return Map(m), nil
+}
+
+// WithDotenv is Default, then the .env file at path and the files of its _FILE vars, or just Default if path is empty
+func WithDotenv(path string) (Source, error) {
+	if path == "" {
+		return Default, nil
+	}
+	dotenv, err := Dotenv(path)
+	if err != nil {
+		return nil, err
+	}
+	return Chain(Default, dotenv, Files(dotenv)), nil
+}
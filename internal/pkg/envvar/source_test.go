@@ -0,0 +1,92 @@
+package envvar
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestReadFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envvar")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, "private_key")
+	testutil.Ok(t, ioutil.WriteFile(secret, []byte("s3cret\n"), 0600))
+
+	dotenv := filepath.Join(dir, ".env")
+	testutil.Ok(t, ioutil.WriteFile(dotenv, []byte(`# comment
+
+export APPNAME=from-dotenv
+PUBLIC_KEY="quoted \"key\""
+PORT='8080'
+PRIVATE_KEY=<insert>
+EMPTY=
+`), 0600))
+	fromDotenv, err := Dotenv(dotenv)
+	testutil.Ok(t, err)
+
+	type config struct {
+		AppName    string `env:"APPNAME"`
+		PublicKey  string `env:"PUBLIC_KEY"`
+		PrivateKey string `env:"PRIVATE_KEY"`
+		Port       int    `env:"PORT"`
+		Empty      string `env:"EMPTY,default=fallback"`
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    config
+		wantErr string
+	}{
+		{
+			name: "dotenv only",
+			want: config{AppName: "from-dotenv", PublicKey: `quoted "key"`, PrivateKey: "<insert>", Port: 8080, Empty: "fallback"},
+		},
+		{
+			name: "env then files then dotenv",
+			env:  map[string]string{"APPNAME": "from-env", "PRIVATE_KEY_FILE": secret, "EMPTY": ""},
+			want: config{AppName: "from-env", PublicKey: `quoted "key"`, PrivateKey: "s3cret", Port: 8080, Empty: "fallback"},
+		},
+		{
+			name: "env wins over files",
+			env:  map[string]string{"PRIVATE_KEY": "from-env", "PRIVATE_KEY_FILE": secret},
+			want: config{AppName: "from-dotenv", PublicKey: `quoted "key"`, PrivateKey: "from-env", Port: 8080, Empty: "fallback"},
+		},
+		{
+			name:    "missing file",
+			env:     map[string]string{"PRIVATE_KEY_FILE": filepath.Join(dir, "nope"), "PORT": "http"},
+			wantErr: "PRIVATE_KEY: reading PRIVATE_KEY_FILE: open " + filepath.Join(dir, "nope") + ": no such file or directory; PORT: strconv.ParseInt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := Map(tt.env)
+			var got config
+			err := ReadFrom(Chain(env, Files(env), fromDotenv), &got)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDotenv_malformed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envvar")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".env")
+	testutil.Ok(t, ioutil.WriteFile(path, []byte("A=1\nnot a var\n"), 0600))
+
+	_, err = Dotenv(path)
+	testutil.CompareError(t, path+":2: not a KEY=VALUE line", err)
+
+	_, err = Dotenv(filepath.Join(dir, "missing"))
+	testutil.CompareError(t, "no such file or directory", err)
+}
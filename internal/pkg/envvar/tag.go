@@ -0,0 +1,179 @@
+package envvar
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// tag is the parsed env tag of a field
+type tag struct {
+	key      string
+	optional bool
+	// def is the value used when the env var is missing, nil if there is none
+	def *string
+	// min and max are parsed as the field, strings, slices and maps are compared by length
+	min, max *bound
+	oneOf    []string
+	url      bool
+	secret   bool
+}
+
+// bound is a min or max rule
+type bound struct {
+	raw   string
+	value float64
+}
+
+// parseTag parses `env:"KEY,option,..."` where the options are
+//
+//	optional    the field is left as is when the env var is missing
+//	default=V   V is used when the env var is missing
+//	min=N       the value, or length of a string, slice or map, is at least N
+//	max=N       the value, or length of a string, slice or map, is at most N
+//	oneof=A B   the value, or each item of a slice, is one of the space separated values
+//	url         the value, or each item of a slice, is an absolute URL
+//	secret      the value is masked by Format
+//
+// A comma not followed by an option is part of the value of the previous option,
+// so that `default=public,max-age=60` works
+func parseTag(field reflect.StructField) (tag, error) {
+	raw, ok := field.Tag.Lookup(tagName)
+	if !ok {
+		return tag{}, fmt.Errorf("env tag not set for field %s", field.Name)
+	}
+
+	parts := strings.Split(raw, ",")
+	t := tag{key: parts[0]}
+
+	var opts []string
+	for _, p := range parts[1:] {
+		name := strings.SplitN(p, "=", 2)[0]
+		if len(opts) > 0 && !isOption(name) {
+			opts[len(opts)-1] += "," + p
+			continue
+		}
+		opts = append(opts, p)
+	}
+
+	for _, opt := range opts {
+		kv := strings.SplitN(opt, "=", 2)
+		name := kv[0]
+		if !isOption(name) {
+			return tag{}, fmt.Errorf("unknown option %q for field %s", name, field.Name)
+		}
+		if hasValue := len(kv) == 2; hasValue != (name != "optional" && name != "url" && name != "secret") {
+			return tag{}, fmt.Errorf("malformed option %q for field %s", opt, field.Name)
+		}
+
+		var err error
+		switch name {
+		case "optional":
+			t.optional = true
+		case "url":
+			t.url = true
+		case "secret":
+			t.secret = true
+		case "default":
+			t.def = &kv[1]
+		case "min":
+			t.min, err = parseBound(field.Type, kv[1])
+		case "max":
+			t.max, err = parseBound(field.Type, kv[1])
+		case "oneof":
+			t.oneOf = strings.Fields(kv[1])
+		}
+		if err != nil {
+			return tag{}, fmt.Errorf("malformed option %q for field %s: %v", opt, field.Name, err)
+		}
+	}
+	return t, nil
+}
+
+func isOption(name string) bool {
+	switch name {
+	case "optional", "default", "min", "max", "oneof", "url", "secret":
+		return true
+	}
+	return false
+}
+
+// parseBound parses the bound as the type of the field, or as an int for lengths
+func parseBound(typ reflect.Type, raw string) (*bound, error) {
+	if hasLength(typ) {
+		typ = reflect.TypeOf(0)
+	}
+	v := reflect.New(typ).Elem()
+	if err := setValue(v, raw); err != nil {
+		return nil, err
+	}
+	return &bound{raw: raw, value: number(v)}, nil
+}
+
+// hasLength is whether the bounds of the type are about its length
+func hasLength(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// number is what the bounds are compared against
+func number(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String, reflect.Slice, reflect.Map:
+		return float64(v.Len())
+	}
+	return 0
+}
+
+// validate checks the field, set from the value, against the rules of the tag
+func (t tag) validate(fieldValue reflect.Value, value string) error {
+	unit := ""
+	switch fieldValue.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Map:
+		unit = " items"
+	}
+	if t.min != nil && number(fieldValue) < t.min.value {
+		return fmt.Errorf("must be at least %s%s", t.min.raw, unit)
+	}
+	if t.max != nil && number(fieldValue) > t.max.value {
+		return fmt.Errorf("must be at most %s%s", t.max.raw, unit)
+	}
+	// the items of a slice are checked one by one
+	items := []string{value}
+	if fieldValue.Kind() == reflect.Slice {
+		items = splitList(value)
+	}
+	for _, item := range items {
+		if len(t.oneOf) > 0 && !contains(t.oneOf, item) {
+			return fmt.Errorf("must be one of %s", strings.Join(t.oneOf, ", "))
+		}
+		if t.url {
+			u, err := url.Parse(item)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("must be an absolute URL")
+			}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
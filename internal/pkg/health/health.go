@@ -0,0 +1,126 @@
+// Package health serves the liveness and readiness of the app
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+)
+
+// DefaultTimeout bounds all the checks of a readiness probe, unless Checker.Timeout is set
+const DefaultTimeout = 2 * time.Second
+
+// Check returns an error should a dependency of the app not be usable
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the checks telling whether the app is ready to serve, it is ready without any check
+type Checker struct {
+	// Timeout bounds all the checks of a readiness probe, DefaultTimeout if zero
+	Timeout time.Duration
+
+	mu       sync.RWMutex
+	checks   []namedCheck
+	draining int32
+}
+
+// Status is the body of the health endpoints
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+	statusDraining    = "draining"
+)
+
+// Add adds a check to the readiness, name being how it is reported
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Drain makes the app not ready for good, so that load balancers stop sending requests before it stops
+func (c *Checker) Drain() {
+	atomic.StoreInt32(&c.draining, 1)
+}
+
+// Ready runs the checks, returning whether they all pass and the outcome of each
+func (c *Checker) Ready(ctx context.Context) (bool, Status) {
+	if atomic.LoadInt32(&c.draining) == 1 {
+		return false, Status{Status: statusDraining}
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	// the checks are run concurrently so that a slow one does not eat the time of the others
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = check(ctx)
+		}(i, nc.check)
+	}
+	wg.Wait()
+
+	ready := true
+	status := Status{Status: statusOK, Checks: make(map[string]string, len(checks))}
+	for i, nc := range checks {
+		if results[i] != nil {
+			ready = false
+			status.Status = statusUnavailable
+			status.Checks[nc.name] = results[i].Error()
+			continue
+		}
+		status.Checks[nc.name] = statusOK
+	}
+	return ready, status
+}
+
+// Liveness answers 200 as long as the app is able to serve at all
+func Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		web.RespondJSON(r.Context(), w, Status{Status: statusOK}, map[string]string{"Cache-Control": "no-store"})
+	})
+}
+
+// Readiness answers 200 should all the checks pass, else 503 with the failing ones
+func (c *Checker) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready, status := c.Ready(r.Context())
+		code := http.StatusOK
+		if !ready {
+			code = http.StatusServiceUnavailable
+		}
+		web.RespondJSONWithStatus(r.Context(), w, code, status, map[string]string{"Cache-Control": "no-store"})
+	})
+}
+
+// Ping returns a Check pinging db, e.g. a *sqlx.DB
+func Ping(db interface {
+	PingContext(ctx context.Context) error
+}) Check {
+	return db.PingContext
+}
@@ -0,0 +1,86 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestChecker_Readiness(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name       string
+		checks     map[string]Check
+		drain      bool
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "no check",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"ok"}`,
+		},
+		{
+			name:       "all pass",
+			checks:     map[string]Check{"db": ok, "migrations": ok},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"ok","checks":{"db":"ok","migrations":"ok"}}`,
+		},
+		{
+			name:       "one fails",
+			checks:     map[string]Check{"db": failing, "migrations": ok},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"status":"unavailable","checks":{"db":"connection refused","migrations":"ok"}}`,
+		},
+		{
+			name:       "one times out",
+			checks:     map[string]Check{"db": slow},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"status":"unavailable","checks":{"db":"context deadline exceeded"}}`,
+		},
+		{
+			name:       "draining",
+			checks:     map[string]Check{"db": ok},
+			drain:      true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"status":"draining"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Checker{Timeout: 20 * time.Millisecond}
+			for name, check := range tt.checks {
+				c.Add(name, check)
+			}
+			if tt.drain {
+				c.Drain()
+			}
+
+			rr := httptest.NewRecorder()
+			c.Readiness().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantBody, rr.Body.String())
+			testutil.Equals(t, "no-store", rr.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Liveness().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	testutil.Equals(t, http.StatusOK, rr.Code)
+	testutil.Equals(t, `{"status":"ok"}`, rr.Body.String())
+}
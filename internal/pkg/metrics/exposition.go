@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WriteText writes the metrics in the Prometheus text format, leaving out those never used
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		children := f.sortedChildren()
+		if len(children) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.kind)
+		for _, ch := range children {
+			ch.mu.Lock()
+			switch f.kind {
+			case histogramKind:
+				// counts are cumulative already, see Observe
+				for i, upper := range f.buckets {
+					writeSample(bw, f.name+"_bucket", f.labels, ch.labelValues, "le", formatFloat(upper), float64(ch.counts[i]))
+				}
+				writeSample(bw, f.name+"_bucket", f.labels, ch.labelValues, "le", "+Inf", float64(ch.count))
+				writeSample(bw, f.name+"_sum", f.labels, ch.labelValues, "", "", ch.sum)
+				writeSample(bw, f.name+"_count", f.labels, ch.labelValues, "", "", float64(ch.count))
+			default:
+				writeSample(bw, f.name, f.labels, ch.labelValues, "", "", ch.value)
+			}
+			ch.mu.Unlock()
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics of the registry in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		if err := r.WriteText(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+// Handler serves the metrics of Default
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// Push sends the metrics of the registry to a Prometheus Pushgateway at gatewayURL, grouped under job.
+// Metrics of the group which are not pushed are kept by the gateway
+func (r *Registry) Push(ctx context.Context, client *http.Client, gatewayURL, job string) error {
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		return err
+	}
+
+	addr := strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("pushgateway answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func writeSample(w io.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	pairs := make([]string, 0, len(labels)+1)
+	for i, l := range labels {
+		pairs = append(pairs, l+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, extraLabel+`="`+extraValue+`"`)
+	}
+
+	if len(pairs) == 0 {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(v))
+		return
+	}
+	fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(v))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
@@ -0,0 +1,212 @@
+// Package metrics keeps counters, gauges and histograms, exported in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets are the upper bounds of the buckets of latency histograms, in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry the package level constructors register with
+var Default = NewRegistry()
+
+type kind string
+
+const (
+	counterKind   kind = "counter"
+	gaugeKind     kind = "gauge"
+	histogramKind kind = "histogram"
+)
+
+// Registry holds metrics, each with a unique name
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Counter is a value which only goes up, per label values
+type Counter struct {
+	f *family
+}
+
+// Gauge is a value which goes up and down, per label values
+type Gauge struct {
+	f *family
+}
+
+// Histogram counts observations in buckets, per label values
+type Histogram struct {
+	f *family
+}
+
+// NewCounter registers a Counter with the given label names. It panics should the name be taken
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{f: r.register(name, help, counterKind, nil, labels)}
+}
+
+// NewGauge registers a Gauge with the given label names. It panics should the name be taken
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{f: r.register(name, help, gaugeKind, nil, labels)}
+}
+
+// NewHistogram registers a Histogram with the given bucket upper bounds, in increasing order,
+// and label names. It panics should the name be taken
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{f: r.register(name, help, histogramKind, buckets, labels)}
+}
+
+// NewCounter registers a Counter with Default
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewGauge registers a Gauge with Default
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewHistogram registers a Histogram with Default
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+func (r *Registry) register(name, help string, k kind, buckets []float64, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.families[name]; ok {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	f := &family{
+		name:     name,
+		help:     help,
+		kind:     k,
+		labels:   labels,
+		buckets:  buckets,
+		children: make(map[string]*child),
+	}
+	r.families[name] = f
+	return f
+}
+
+// Inc adds 1 to the counter of the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter of the label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: %s decreased", c.f.name))
+	}
+	ch := c.f.child(labelValues)
+	ch.mu.Lock()
+	ch.value += v
+	ch.mu.Unlock()
+}
+
+// Set sets the gauge of the label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	ch := g.f.child(labelValues)
+	ch.mu.Lock()
+	ch.value = v
+	ch.mu.Unlock()
+}
+
+// Add adds v, which may be negative, to the gauge of the label values
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	ch := g.f.child(labelValues)
+	ch.mu.Lock()
+	ch.value += v
+	ch.mu.Unlock()
+}
+
+// ObserveSince counts the seconds elapsed since start in the histogram of the label values
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Observe counts v in the histogram of the label values, in every bucket it fits in
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	ch := h.f.child(labelValues)
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for i, upper := range h.f.buckets {
+		if v <= upper {
+			ch.counts[i]++
+		}
+	}
+	ch.sum += v
+	ch.count++
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+
+	mu       sync.Mutex
+	children map[string]*child
+}
+
+// child is the metric of a set of label values, it is only exported once used
+type child struct {
+	labelValues []string
+
+	mu     sync.Mutex
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (f *family) child(labelValues []string) *child {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\x00")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch, ok := f.children[key]
+	if !ok {
+		ch = &child{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == histogramKind {
+			ch.counts = make([]uint64, len(f.buckets))
+		}
+		f.children[key] = ch
+	}
+	return ch
+}
+
+// sortedChildren returns the children ordered by label values, so that the output is stable
+func (f *family) sortedChildren() []*child {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.children))
+	for k := range f.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	children := make([]*child, len(keys))
+	for i, k := range keys {
+		children[i] = f.children[k]
+	}
+	return children
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("http_requests_total", "HTTP requests served.", "route", "status")
+	lastSuccess := r.NewGauge("last_success_timestamp_seconds", "When the last\nsync succeeded.")
+	latency := r.NewHistogram("query_duration_seconds", "Query latency.", []float64{0.1, 1}, "query")
+	r.NewCounter("unused_total", "Never used.")
+
+	requests.Inc("/characters", "200")
+	requests.Add(2, "/characters", "200")
+	requests.Inc(`/characters/{id:[0-9]+}`, "404")
+	lastSuccess.Set(1.6148e9)
+	latency.Observe(0.05, "get_character")
+	latency.Observe(0.5, "get_character")
+	latency.Observe(3, "get_character")
+
+	var buf bytes.Buffer
+	testutil.Ok(t, r.WriteText(&buf))
+	testutil.Equals(t, `# HELP http_requests_total HTTP requests served.
+# TYPE http_requests_total counter
+http_requests_total{route="/characters",status="200"} 3
+http_requests_total{route="/characters/{id:[0-9]+}",status="404"} 1
+# HELP last_success_timestamp_seconds When the last\nsync succeeded.
+# TYPE last_success_timestamp_seconds gauge
+last_success_timestamp_seconds 1.6148e+09
+# HELP query_duration_seconds Query latency.
+# TYPE query_duration_seconds histogram
+query_duration_seconds_bucket{query="get_character",le="0.1"} 1
+query_duration_seconds_bucket{query="get_character",le="1"} 2
+query_duration_seconds_bucket{query="get_character",le="+Inf"} 3
+query_duration_seconds_sum{query="get_character"} 3.55
+query_duration_seconds_count{query="get_character"} 3
+`, buf.String())
+}
+
+func TestRegistry_labels(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("marvel_requests_total", "Calls to Marvel.", "status")
+	c.Inc("say \"hi\"\\\n")
+
+	var buf bytes.Buffer
+	testutil.Ok(t, r.WriteText(&buf))
+	testutil.Asserts(t, bytes.Contains(buf.Bytes(), []byte(`{status="say \"hi\"\\\n"}`)), "label value should be escaped, got %s", buf.String())
+
+	defer func() {
+		testutil.Asserts(t, recover() != nil, "wrong number of label values should panic")
+	}()
+	c.Inc()
+}
+
+func TestRegistry_registeredTwice(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("up", "Up.")
+	defer func() {
+		testutil.Asserts(t, recover() != nil, "registering a name twice should panic")
+	}()
+	r.NewCounter("up", "Up again.")
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("up", "Up.").Set(1)
+
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	testutil.Equals(t, http.StatusOK, rr.Code)
+	testutil.Equals(t, ContentType, rr.Header().Get("Content-Type"))
+	testutil.Equals(t, "# HELP up Up.\n# TYPE up gauge\nup 1\n", rr.Body.String())
+}
+
+func TestRegistry_Push(t *testing.T) {
+	var gotPath, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, http.MethodPost, r.Method)
+		b, _ := ioutil.ReadAll(r.Body)
+		gotPath, gotBody = r.URL.Path, string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	r := NewRegistry()
+	r.NewGauge("up", "Up.").Set(1)
+	testutil.Ok(t, r.Push(context.Background(), srv.Client(), srv.URL+"/", "bifrost"))
+	testutil.Equals(t, "/metrics/job/bifrost", gotPath)
+	testutil.Equals(t, "# HELP up Up.\n# TYPE up gauge\nup 1\n", gotBody)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	testutil.CompareError(t, "pushgateway answered 400", r.Push(context.Background(), failing.Client(), failing.URL, "bifrost"))
+}
@@ -0,0 +1,88 @@
+// Package ops serves the internal endpoints of the binaries: pprof, runtime info and the build version
+package ops
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+)
+
+// Version, Commit and BuildTime are set when building, e.g.
+// go build -ldflags "-X github.com/kagelui/marvel-forwarder/internal/pkg/ops.Version=v1.2.0"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+var started = time.Now()
+
+// Build is the body of /version
+type Build struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Runtime is the body of /debug/runtime
+type Runtime struct {
+	Build
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	Goroutines    int     `json:"goroutines"`
+	GOMAXPROCS    int     `json:"gomaxprocs"`
+	NumCPU        int     `json:"num_cpu"`
+	HeapAlloc     uint64  `json:"heap_alloc_bytes"`
+	HeapObjects   uint64  `json:"heap_objects"`
+	Sys           uint64  `json:"sys_bytes"`
+	NumGC         uint32  `json:"num_gc"`
+	LastGC        string  `json:"last_gc,omitempty"`
+}
+
+// CurrentBuild is the version the binary was built with
+func CurrentBuild() Build {
+	return Build{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+}
+
+// Mux returns a mux of /version, /debug/runtime and the /debug/pprof/ endpoints,
+// which is not meant to be reachable from the public port
+func Mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		web.RespondJSON(r.Context(), w, CurrentBuild(), map[string]string{"Cache-Control": "no-store"})
+	})
+	mux.HandleFunc("/debug/runtime", func(w http.ResponseWriter, r *http.Request) {
+		web.RespondJSON(r.Context(), w, currentRuntime(), map[string]string{"Cache-Control": "no-store"})
+	})
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+func currentRuntime() Runtime {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	rt := Runtime{
+		Build:         CurrentBuild(),
+		UptimeSeconds: time.Since(started).Seconds(),
+		Goroutines:    runtime.NumGoroutine(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		NumCPU:        runtime.NumCPU(),
+		HeapAlloc:     m.HeapAlloc,
+		HeapObjects:   m.HeapObjects,
+		Sys:           m.Sys,
+		NumGC:         m.NumGC,
+	}
+	if m.LastGC > 0 {
+		rt.LastGC = time.Unix(0, int64(m.LastGC)).UTC().Format(time.RFC3339)
+	}
+	return rt
+}
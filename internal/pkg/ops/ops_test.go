@@ -0,0 +1,39 @@
+package ops
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestMux(t *testing.T) {
+	Version, Commit = "v1.2.0", "abc123"
+	defer func() { Version, Commit = "dev", "unknown" }()
+
+	mux := Mux()
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/version", nil))
+	testutil.Equals(t, http.StatusOK, rr.Code)
+	var build Build
+	testutil.Ok(t, json.Unmarshal(rr.Body.Bytes(), &build))
+	testutil.Equals(t, Build{Version: "v1.2.0", Commit: "abc123", BuildTime: "unknown", GoVersion: runtime.Version()}, build)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/runtime", nil))
+	testutil.Equals(t, http.StatusOK, rr.Code)
+	var rt Runtime
+	testutil.Ok(t, json.Unmarshal(rr.Body.Bytes(), &rt))
+	testutil.Equals(t, "v1.2.0", rt.Version)
+	testutil.Asserts(t, rt.Goroutines > 0 && rt.NumCPU > 0 && rt.HeapAlloc > 0, "runtime info should be filled, got %+v", rt)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	testutil.Equals(t, http.StatusOK, rr.Code)
+	testutil.Asserts(t, strings.Contains(rr.Body.String(), "goroutine"), "pprof index should list the profiles")
+}
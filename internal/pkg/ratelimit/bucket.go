@@ -0,0 +1,76 @@
+// Package ratelimit implements token bucket rate limiting
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket refilled at Rate tokens per second, holding at most Burst tokens
+type Bucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a full Bucket
+func NewBucket(rate float64, burst int) *Bucket {
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Take takes a token at now if there is one. Otherwise it returns how long to wait
+// until there is one, or a negative duration if there never will be
+func (b *Bucket) Take(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.rate <= 0 {
+		return false, -1
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Remaining returns the number of whole tokens left after the last Take
+func (b *Bucket) Remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int(b.tokens)
+}
+
+// Limiter keeps a Bucket per key
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+}
+
+// NewLimiter returns an empty Limiter
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[string]*Bucket)}
+}
+
+// Allow takes a token from the bucket of key, created with rate and burst should it be
+// missing or should its limits have changed. See Bucket.Take for the returned values
+func (l *Limiter) Allow(key string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	b, ok := l.buckets[key]
+	if !ok || b.rate != rate || b.burst != float64(burst) {
+		b = NewBucket(rate, burst)
+		l.buckets[key] = b
+	}
+	l.mu.Unlock()
+
+	return b.Take(now)
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestBucket_Take(t *testing.T) {
+	start := time.Date(2021, time.March, 3, 10, 0, 0, 0, time.UTC)
+	type take struct {
+		at       time.Duration
+		wantOk   bool
+		wantWait time.Duration
+	}
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		takes []take
+	}{
+		{
+			name:  "burst then refill",
+			rate:  2,
+			burst: 2,
+			takes: []take{
+				{at: 0, wantOk: true},
+				{at: 0, wantOk: true},
+				{at: 0, wantOk: false, wantWait: 500 * time.Millisecond},
+				{at: 250 * time.Millisecond, wantOk: false, wantWait: 250 * time.Millisecond},
+				{at: 500 * time.Millisecond, wantOk: true},
+				{at: 10 * time.Second, wantOk: true},
+				{at: 10 * time.Second, wantOk: true},
+				{at: 10 * time.Second, wantOk: false, wantWait: 500 * time.Millisecond},
+			},
+		},
+		{
+			name:  "never refilled",
+			rate:  0,
+			burst: 1,
+			takes: []take{
+				{at: 0, wantOk: true},
+				{at: time.Hour, wantOk: false, wantWait: -1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBucket(tt.rate, tt.burst)
+			for _, tk := range tt.takes {
+				ok, wait := b.Take(start.Add(tk.at))
+				testutil.Equals(t, tk.wantOk, ok)
+				testutil.Equals(t, tk.wantWait, wait)
+			}
+		})
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter()
+
+	ok, _ := l.Allow("a", 1, 1, now)
+	testutil.Asserts(t, ok, "first call should be allowed")
+	ok, _ = l.Allow("a", 1, 1, now)
+	testutil.Asserts(t, !ok, "second call should be limited")
+	ok, _ = l.Allow("b", 1, 1, now)
+	testutil.Asserts(t, ok, "keys should have their own bucket")
+	ok, _ = l.Allow("a", 1, 5, now)
+	testutil.Asserts(t, ok, "changed limits should give a new bucket")
+}
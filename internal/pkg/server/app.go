@@ -2,68 +2,204 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
 
+// Config of the App, read with envvar
+type Config struct {
+	Addr string `env:"ADDR,default=:8080"`
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout are those of http.Server, none if 0
+	ReadHeaderTimeout time.Duration `env:"READ_HEADER_TIMEOUT,default=5s"`
+	ReadTimeout       time.Duration `env:"READ_TIMEOUT,default=30s"`
+	WriteTimeout      time.Duration `env:"WRITE_TIMEOUT,default=60s"`
+	IdleTimeout       time.Duration `env:"IDLE_TIMEOUT,default=2m"`
+	MaxHeaderBytes    int           `env:"MAX_HEADER_BYTES,default=1048576,min=1"`
+	// TLSCertFile and TLSKeyFile serve HTTPS when set, they are loaded again on SIGHUP
+	TLSCertFile string `env:"TLS_CERT_FILE,optional"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE,optional"`
+	// DrainDelay is how long the server keeps serving after SIGTERM, for load balancers to stop sending requests
+	DrainDelay time.Duration `env:"DRAIN_DELAY,default=10s"`
+	// ShutdownTimeout is how long the in flight requests are waited for before closing the connections
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT,default=5s"`
+}
+
 type App struct {
-	server *http.Server
-	logger *log.Logger
+	cfg     Config
+	server  *http.Server
+	others  []*http.Server
+	logger  *log.Logger
+	onDrain []func()
 }
 
-func New(addr string, handler http.Handler) *App {
-	return &App{
-		server: &http.Server{Addr: addr, Handler: handler},
+func New(cfg Config, handler http.Handler) *App {
+	a := &App{
+		cfg:    cfg,
 		logger: log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lshortfile),
 	}
+	a.server = a.newServer(cfg.Addr, handler)
+	return a
+}
+
+func (a *App) newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: a.cfg.ReadHeaderTimeout,
+		ReadTimeout:       a.cfg.ReadTimeout,
+		WriteTimeout:      a.cfg.WriteTimeout,
+		IdleTimeout:       a.cfg.IdleTimeout,
+		MaxHeaderBytes:    a.cfg.MaxHeaderBytes,
+	}
+}
+
+// Listen adds a listener at addr, with the timeouts and the TLS cert of the config, which is started
+// and stopped along with the main one, e.g. to keep the ops endpoints off the public port
+func (a *App) Listen(addr string, handler http.Handler) {
+	a.others = append(a.others, a.newServer(addr, handler))
+}
+
+// servers is the main server then the others
+func (a *App) servers() []*http.Server {
+	return append([]*http.Server{a.server}, a.others...)
 }
 
-// Start starts the server asynchronously and wait for termination
-func (a *App) Start() {
-	// starts server asynchronously
-	go func() {
-		a.logger.Printf("Server started at port %s", a.server.Addr)
-		if err := a.server.ListenAndServe(); err != http.ErrServerClosed {
-			a.logger.Fatalf("ListenAndServe: %s", err)
+// OnDrain registers fn to be called once termination is requested, before the buffer
+// sleep, e.g. to fail the readiness so that load balancers stop sending requests
+func (a *App) OnDrain(fn func()) {
+	a.onDrain = append(a.onDrain, fn)
+}
+
+// Start starts the server and waits for termination, returning why the server could not serve
+func (a *App) Start() error {
+	var certs *certReloader
+	if a.cfg.TLSCertFile != "" || a.cfg.TLSKeyFile != "" {
+		if a.cfg.TLSCertFile == "" || a.cfg.TLSKeyFile == "" {
+			return errors.New("both the TLS cert and key files are needed")
+		}
+		var err error
+		if certs, err = newCertReloader(a.cfg.TLSCertFile, a.cfg.TLSKeyFile); err != nil {
+			return err
 		}
-	}()
+	}
+
+	// every address is bound before serving, so that none is served should one be taken
+	servers := a.servers()
+	listeners := make([]net.Listener, 0, len(servers))
+	for _, srv := range servers {
+		ln, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+	// the other listeners are just as encrypted, as they may serve what is even more sensitive
+	if certs != nil {
+		tlsConfig := &tls.Config{GetCertificate: certs.GetCertificate}
+		for i, ln := range listeners {
+			listeners[i] = tls.NewListener(ln, tlsConfig)
+		}
+	}
+
+	// serves asynchronously
+	serveErr := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func(srv *http.Server, ln net.Listener) {
+			a.logger.Printf("Server started at %s, TLS %t", ln.Addr(), certs != nil)
+			serveErr <- srv.Serve(ln)
+		}(srv, listeners[i])
+	}
 
 	// Handle graceful shutdown
-	// Channel to listen for an interrupt or terminate signal from the OS.
+	// Channel to listen for an interrupt or terminate signal from the OS, or a reload of the certs.
 	osSignals := make(chan os.Signal, 1)
-	signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM)
-	// Block waiting for a receive on signal from OS
-	s := <-osSignals
-	switch s {
-	case syscall.SIGTERM:
-		d := 10 * time.Second
-		a.logger.Printf("SIGTERM received. Sleeping for %s as buffer before stopping server", d)
-		// Delay 10 seconds as buffer
-		time.Sleep(d)
-	}
+	signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(osSignals)
+
+	for {
+		// Block waiting for a receive on signal from OS
+		var s os.Signal
+		select {
+		case err := <-serveErr:
+			_ = a.Stop()
+			return fmt.Errorf("serving: %w", err)
+		case s = <-osSignals:
+		}
 
-	// Shutdown gracefully
-	a.Stop()
+		if s == syscall.SIGHUP {
+			if certs == nil {
+				continue
+			}
+			if err := certs.reload(); err != nil {
+				a.logger.Printf("Could not reload the TLS cert, keeping the current one: %v", err)
+				continue
+			}
+			a.logger.Printf("TLS cert reloaded")
+			continue
+		}
+
+		for _, fn := range a.onDrain {
+			fn()
+		}
+		if s == syscall.SIGTERM && a.cfg.DrainDelay > 0 {
+			a.logger.Printf("SIGTERM received. Sleeping for %s as buffer before stopping server", a.cfg.DrainDelay)
+			time.Sleep(a.cfg.DrainDelay)
+		}
+
+		// Shutdown gracefully
+		return a.Stop()
+	}
 }
 
-// Stop stops the app
-func (a *App) Stop() {
-	// Create a context to attempt a graceful 5 second shutdown.
-	const timeout = 5 * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+// Stop stops every listener of the app at once, closing the connections should the in flight
+// requests not complete in time
+func (a *App) Stop() error {
+	// Create a context to attempt a graceful shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
 	defer cancel()
 
+	servers := a.servers()
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			errs[i] = a.stop(ctx, srv)
+		}(i, srv)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *App) stop(ctx context.Context, srv *http.Server) error {
 	// Attempt the graceful shutdown by closing the listener and
 	// completing all inflight requests.
-	if err := a.server.Shutdown(ctx); err != nil {
-		a.logger.Printf("Could not stop server gracefully: %v", err)
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		a.logger.Printf("Could not stop server at %s gracefully: %v", srv.Addr, err)
 		a.logger.Printf("Initiating hard shutdown")
-		if err := a.server.Close(); err != nil {
+		if err := srv.Close(); err != nil {
 			a.logger.Printf("Could not stop http server: %v", err)
 		}
 	}
+	return err
 }
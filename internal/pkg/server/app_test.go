@@ -0,0 +1,190 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestApp_Start_errors(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	defer busy.Close()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		other   string
+		wantErr string
+	}{
+		{name: "cert without key", cfg: Config{Addr: "127.0.0.1:0", TLSCertFile: "cert.pem"}, wantErr: "both the TLS cert and key files are needed"},
+		{name: "missing cert", cfg: Config{Addr: "127.0.0.1:0", TLSCertFile: "cert.pem", TLSKeyFile: "key.pem"}, wantErr: "open cert.pem: no such file or directory"},
+		{name: "address in use", cfg: Config{Addr: busy.Addr().String()}, wantErr: "address already in use"},
+		{name: "other address in use", cfg: Config{Addr: "127.0.0.1:0"}, other: busy.Addr().String(), wantErr: "address already in use"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := New(tt.cfg, http.NotFoundHandler())
+			if tt.other != "" {
+				app.Listen(tt.other, http.NotFoundHandler())
+			}
+			testutil.CompareError(t, tt.wantErr, app.Start())
+		})
+	}
+}
+
+func TestApp_Start(t *testing.T) {
+	addr, opsAddr := freeAddr(t), freeAddr(t)
+	app := New(Config{Addr: addr, ShutdownTimeout: time.Second}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	app.Listen(opsAddr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	drained := false
+	app.OnDrain(func() { drained = true })
+
+	done := make(chan error, 1)
+	go func() { done <- app.Start() }()
+
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get("http://" + addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	testutil.Ok(t, err)
+	resp.Body.Close()
+	testutil.Equals(t, http.StatusTeapot, resp.StatusCode)
+
+	resp, err = http.Get("http://" + opsAddr)
+	testutil.Ok(t, err)
+	resp.Body.Close()
+	testutil.Equals(t, http.StatusNoContent, resp.StatusCode)
+
+	testutil.Ok(t, syscall.Kill(os.Getpid(), syscall.SIGINT))
+	select {
+	case err := <-done:
+		testutil.Ok(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the app did not stop")
+	}
+	testutil.Asserts(t, drained, "the drain funcs should be called")
+
+	_, err = http.Get("http://" + opsAddr)
+	testutil.Asserts(t, err != nil, "the other listener should be stopped too")
+}
+
+func TestApp_Start_tls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "serverd")
+
+	addr, opsAddr := freeAddr(t), freeAddr(t)
+	app := New(Config{Addr: addr, TLSCertFile: certFile, TLSKeyFile: keyFile, ShutdownTimeout: time.Second}, http.NotFoundHandler())
+	app.Listen(opsAddr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	done := make(chan error, 1)
+	go func() { done <- app.Start() }()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("https://" + opsAddr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	testutil.Ok(t, err)
+	resp.Body.Close()
+	testutil.Equals(t, http.StatusNoContent, resp.StatusCode)
+	testutil.Equals(t, "serverd", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	// plain HTTP is answered by the TLS server with a 400
+	resp, err = http.Get("http://" + opsAddr)
+	testutil.Ok(t, err)
+	resp.Body.Close()
+	testutil.Equals(t, http.StatusBadRequest, resp.StatusCode)
+
+	testutil.Ok(t, syscall.Kill(os.Getpid(), syscall.SIGINT))
+	select {
+	case err := <-done:
+		testutil.Ok(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the app did not stop")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	writeCert(t, certFile, keyFile, "first")
+	c, err := newCertReloader(certFile, keyFile)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "first", commonName(t, c))
+
+	writeCert(t, certFile, keyFile, "second")
+	testutil.Ok(t, c.reload())
+	testutil.Equals(t, "second", commonName(t, c))
+
+	testutil.Ok(t, ioutil.WriteFile(keyFile, []byte("not a key"), 0600))
+	testutil.CompareError(t, "tls: failed to find any PEM data in key input", c.reload())
+	testutil.Equals(t, "second", commonName(t, c))
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func commonName(t *testing.T, c *certReloader) string {
+	cert, err := c.GetCertificate(&tls.ClientHelloInfo{})
+	testutil.Ok(t, err)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	testutil.Ok(t, err)
+	return parsed.Subject.CommonName
+}
+
+func writeCert(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testutil.Ok(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	testutil.Ok(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	testutil.Ok(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
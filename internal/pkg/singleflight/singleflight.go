@@ -0,0 +1,116 @@
+// Package singleflight suppresses duplicate calls made concurrently for the same key
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+
+	dups  int
+	chans []chan<- Result
+}
+
+// Result is the result of a call, as sent by DoChan
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
+
+// Group runs at most one call per key at a time, the zero value is ready to use
+type Group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+// Do runs fn for the key and returns its result. Callers arriving while fn is in
+// flight wait for it and share its result instead of running fn again; shared
+// reports whether the result was given to more than one caller
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	g.doCall(c, key, fn)
+	return c.val, c.err, c.dups > 0
+}
+
+// DoChan is Do sending the result on the returned channel once ready, so that the caller
+// may stop waiting for it, e.g. once its context is done
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := &call{chans: []chan<- Result{ch}}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// DoContext is DoChan for callers with their own contexts. fn is run with a context carrying the
+// values of ctx but neither its deadline nor its cancellation, bounded by timeout instead, so that
+// the caller starting the call going away does not fail the others. Each caller returns as soon
+// as its own ctx is done
+func (g *Group) DoContext(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	ch := g.DoChan(key, func() (interface{}, error) {
+		callCtx, cancel := context.WithTimeout(detached{ctx}, timeout)
+		defer cancel()
+		return fn(callCtx)
+	})
+	select {
+	case res := <-ch:
+		return res.Val, res.Err, res.Shared
+	case <-ctx.Done():
+		return nil, ctx.Err(), false
+	}
+}
+
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.m, key)
+	for _, ch := range c.chans {
+		ch <- Result{Val: c.val, Err: c.err, Shared: c.dups > 0}
+	}
+	g.mu.Unlock()
+}
+
+// detached is a context with the values of its parent, which is never done
+type detached struct {
+	parent context.Context
+}
+
+func (d detached) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (d detached) Done() <-chan struct{}             { return nil }
+func (d detached) Err() error                        { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
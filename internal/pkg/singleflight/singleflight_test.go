@@ -0,0 +1,106 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestGroup_Do(t *testing.T) {
+	var g Group
+	v, err, shared := g.Do("key", func() (interface{}, error) {
+		return "value", nil
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, "value", v)
+	testutil.Asserts(t, !shared, "lone call should not be shared")
+
+	_, err, _ = g.Do("key", func() (interface{}, error) {
+		return nil, errors.New("some error")
+	})
+	testutil.CompareError(t, "some error", err)
+}
+
+func TestGroup_Do_coalesces(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, _ = g.Do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return 42, nil
+			})
+		}(i)
+	}
+	// give the goroutines time to pile up behind the first call
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	testutil.Equals(t, int32(1), atomic.LoadInt32(&calls))
+	for _, r := range results {
+		testutil.Equals(t, 42, r)
+	}
+}
+
+func TestGroup_DoContext(t *testing.T) {
+	var g Group
+	started, release := make(chan struct{}), make(chan struct{})
+	type ctxKey struct{}
+
+	// the first caller goes away while the call is in flight
+	first, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "request"))
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err, _ := g.DoContext(first, "key", time.Minute, func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return ctx.Value(ctxKey{}), nil
+		})
+		firstErr <- err
+	}()
+	<-started
+
+	second := make(chan Result, 1)
+	go func() {
+		v, err, shared := g.DoContext(context.Background(), "key", time.Minute, func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("should not be called")
+		})
+		second <- Result{Val: v, Err: err, Shared: shared}
+	}()
+	// give the second caller time to join the call
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	testutil.CompareError(t, context.Canceled.Error(), <-firstErr)
+	close(release)
+	res := <-second
+	testutil.Ok(t, res.Err)
+	testutil.Equals(t, "request", res.Val)
+	testutil.Asserts(t, res.Shared, "the result should be shared")
+}
+
+func TestGroup_DoContext_timeout(t *testing.T) {
+	var g Group
+	_, err, _ := g.DoContext(context.Background(), "key", time.Millisecond, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	testutil.CompareError(t, context.DeadlineExceeded.Error(), err)
+}
@@ -0,0 +1,142 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+)
+
+// RequestIDHeader is the header carrying the ID of a request, from the client or generated
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs accepted from clients, longer ones are replaced
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+// AccessLogOptions configures AccessLog
+type AccessLogOptions struct {
+	// Route returns the route template matched by the request, e.g. /characters/{id}, if any
+	Route func(r *http.Request) string
+}
+
+// AccessLog gives each request an ID, taken from X-Request-ID or generated, and a logger
+// with the method, path, route, client IP and request ID in the request context.
+// It logs a line with the status, bytes written and latency once the request is served, or aborted
+// by a panic, e.g. http.ErrAbortHandler, which is then panicked again
+func AccessLog(opts AccessLogOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			fields := map[string]interface{}{
+				"request_id": id,
+				"method":     r.Method,
+				"path":       r.URL.Path,
+				"client_ip":  clientIP(r),
+			}
+			if opts.Route != nil {
+				if route := opts.Route(r); route != "" {
+					fields["route"] = route
+				}
+			}
+			logger := loglib.GetLogger(r.Context()).WithFields(fields)
+
+			ctx := context.WithValue(loglib.SetLogger(r.Context(), logger), requestIDContextKey{}, id)
+			rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				v := recover()
+				fields := map[string]interface{}{
+					"status":     rw.status,
+					"bytes":      rw.bytes,
+					"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+				}
+				if v == nil {
+					logger.WithFields(fields).InfoF("[Web access] %s %s %d", r.Method, r.URL.Path, rw.status)
+					return
+				}
+				fields["aborted"] = true
+				logger.WithFields(fields).ErrorF("[Web access] %s %s %d aborted", r.Method, r.URL.Path, rw.status)
+				panic(v)
+			}()
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFromContext returns the ID given to the request by AccessLog
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDContextKey{}).(string)
+	return id, ok
+}
+
+// validRequestID accepts IDs of printable ASCII without spaces, so that they are safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// an ID which is not unique beats failing the request
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// responseRecorder remembers the status and the number of bytes written
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += n
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (rw *responseRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestID     string
+		wantGenerated bool
+	}{
+		{name: "request ID from the client", requestID: "c0ffee-42"},
+		{name: "no request ID", wantGenerated: true},
+		{name: "request ID with spaces", requestID: "c0ffee 42", wantGenerated: true},
+		{name: "request ID too long", requestID: strings.Repeat("a", maxRequestIDLength+1), wantGenerated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			base := logrus.New()
+			base.Out = &out
+			base.Formatter = &logrus.JSONFormatter{}
+
+			var handlerID string
+			h := AccessLog(AccessLogOptions{
+				Route: func(r *http.Request) string { return "/characters/{id}" },
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerID, _ = RequestIDFromContext(r.Context())
+				loglib.GetLogger(r.Context()).InfoF("in handler")
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte("nope"))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/characters/1009610", nil)
+			req.RemoteAddr = "10.0.0.7:52311"
+			req = req.WithContext(loglib.SetLogger(req.Context(), loglib.NewLogger(logrus.NewEntry(base))))
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			id := rr.Header().Get(RequestIDHeader)
+			testutil.Equals(t, id, handlerID)
+			if tt.wantGenerated {
+				testutil.Equals(t, 32, len(id))
+			} else {
+				testutil.Equals(t, tt.requestID, id)
+			}
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			testutil.Equals(t, 2, len(lines))
+			var inHandler, access map[string]interface{}
+			testutil.Ok(t, json.Unmarshal([]byte(lines[0]), &inHandler))
+			testutil.Ok(t, json.Unmarshal([]byte(lines[1]), &access))
+
+			for _, fields := range []map[string]interface{}{inHandler, access} {
+				testutil.Equals(t, id, fields["request_id"])
+				testutil.Equals(t, "GET", fields["method"])
+				testutil.Equals(t, "/characters/1009610", fields["path"])
+				testutil.Equals(t, "/characters/{id}", fields["route"])
+				testutil.Equals(t, "10.0.0.7", fields["client_ip"])
+			}
+			testutil.Equals(t, float64(http.StatusNotFound), access["status"])
+			testutil.Equals(t, float64(4), access["bytes"])
+			_, ok := access["latency_ms"].(float64)
+			testutil.Asserts(t, ok, "latency should be logged")
+		})
+	}
+}
+
+func TestAccessLog_aborted(t *testing.T) {
+	var out bytes.Buffer
+	base := logrus.New()
+	base.Out = &out
+	base.Formatter = &logrus.JSONFormatter{}
+
+	h := AccessLog(AccessLogOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("cut"))
+		panic(http.ErrAbortHandler)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/export/characters", nil)
+	req = req.WithContext(loglib.SetLogger(req.Context(), loglib.NewLogger(logrus.NewEntry(base))))
+	defer func() {
+		v := recover()
+		testutil.Asserts(t, v == http.ErrAbortHandler, "the abort should be panicked again, got %v", v)
+
+		var access map[string]interface{}
+		testutil.Ok(t, json.Unmarshal(bytes.TrimSpace(out.Bytes()), &access))
+		testutil.Equals(t, float64(http.StatusOK), access["status"])
+		testutil.Equals(t, float64(3), access["bytes"])
+		testutil.Equals(t, true, access["aborted"])
+		testutil.Equals(t, "error", access["level"])
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
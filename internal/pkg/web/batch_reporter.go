@@ -0,0 +1,184 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+)
+
+// BatchOptions configures how a BatchReporter batches the reports
+type BatchOptions struct {
+	// Size is the number of reports sent at once, 50 if zero
+	Size int
+	// Interval is how long a report waits at most for the batch to fill up, 10s if zero
+	Interval time.Duration
+	// Buffer is the number of reports held waiting to be sent, more are dropped, 1000 if zero
+	Buffer int
+}
+
+// BatchReporter is a Reporter sending the reports in batches, in the background
+type BatchReporter struct {
+	name    string
+	send    func(ctx context.Context, reports []Report) error
+	opts    BatchOptions
+	reports chan Report
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewBatchReporter returns a BatchReporter calling send with the batches, name is used in the logs
+func NewBatchReporter(name string, send func(ctx context.Context, reports []Report) error, opts BatchOptions) *BatchReporter {
+	if opts.Size <= 0 {
+		opts.Size = 50
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 1000
+	}
+
+	b := &BatchReporter{
+		name:    name,
+		send:    send,
+		opts:    opts,
+		reports: make(chan Report, opts.Buffer),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Report queues the report, dropping it should the buffer be full
+func (b *BatchReporter) Report(r Report) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+
+	select {
+	case b.reports <- r:
+	default:
+		loglib.DefaultLogger().WarnF("[Web reporter] %s buffer full, dropping report of %s", b.name, r.Message)
+	}
+}
+
+// Close sends the queued reports and stops the reporter
+func (b *BatchReporter) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.reports)
+	}
+	b.mu.Unlock()
+	<-b.done
+}
+
+func (b *BatchReporter) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.opts.Interval)
+	defer ticker.Stop()
+
+	batch := make([]Report, 0, b.opts.Size)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.opts.Interval)
+		defer cancel()
+		if err := b.send(ctx, batch); err != nil {
+			loglib.DefaultLogger().ErrorF("[Web reporter] %s dropping %d reports: %s", b.name, len(batch), err)
+		}
+		batch = make([]Report, 0, b.opts.Size)
+	}
+
+	for {
+		select {
+		case r, ok := <-b.reports:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= b.opts.Size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// NewWebhookReporter returns a BatchReporter POSTing the batches to url as {"reports": [...]}
+func NewWebhookReporter(url string, client *http.Client, opts BatchOptions) *BatchReporter {
+	return NewBatchReporter("webhook", func(ctx context.Context, reports []Report) error {
+		body, err := json.Marshal(struct {
+			Reports []Report `json:"reports"`
+		}{reports})
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook answered %d", resp.StatusCode)
+		}
+		return nil
+	}, opts)
+}
+
+// NewFileReporter returns a BatchReporter appending the reports to the file at path, one JSON object per line
+func NewFileReporter(path string, opts BatchOptions) (*BatchReporter, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// the file is only checked here, it is opened again for each batch so that it can be rotated
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+
+	return NewBatchReporter("file", func(ctx context.Context, reports []Report) error {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+
+		w := bufio.NewWriter(f)
+		enc := json.NewEncoder(w)
+		for _, r := range reports {
+			if err = enc.Encode(r); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, opts), nil
+}
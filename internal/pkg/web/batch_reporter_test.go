@@ -0,0 +1,103 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestBatchReporter(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches [][]string
+	)
+	b := NewBatchReporter("test", func(ctx context.Context, reports []Report) error {
+		mu.Lock()
+		defer mu.Unlock()
+		var batch []string
+		for _, r := range reports {
+			batch = append(batch, r.Message)
+		}
+		batches = append(batches, batch)
+		return nil
+	}, BatchOptions{Size: 2, Interval: time.Hour})
+
+	for _, m := range []string{"a", "b", "c"} {
+		b.Report(Report{Message: m})
+	}
+	b.Close()
+	b.Report(Report{Message: "after close"})
+
+	testutil.Equals(t, [][]string{{"a", "b"}, {"c"}}, batches)
+}
+
+func TestBatchReporter_interval(t *testing.T) {
+	sent := make(chan int, 1)
+	b := NewBatchReporter("test", func(ctx context.Context, reports []Report) error {
+		sent <- len(reports)
+		return nil
+	}, BatchOptions{Size: 10, Interval: 10 * time.Millisecond})
+	defer b.Close()
+
+	b.Report(Report{Message: "a"})
+	select {
+	case n := <-sent:
+		testutil.Equals(t, 1, n)
+	case <-time.After(time.Second):
+		t.Fatal("batch should be sent after the interval")
+	}
+}
+
+func TestNewWebhookReporter(t *testing.T) {
+	var got struct {
+		Reports []Report `json:"reports"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, http.MethodPost, r.Method)
+		testutil.Equals(t, "application/json", r.Header.Get("Content-Type"))
+		testutil.Ok(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	b := NewWebhookReporter(srv.URL, srv.Client(), BatchOptions{})
+	b.Report(Report{Status: 500, Code: "internal_error", Message: "db down", RequestID: "c0ffee"})
+	b.Close()
+
+	testutil.Equals(t, 1, len(got.Reports))
+	testutil.Equals(t, "c0ffee", got.Reports[0].RequestID)
+}
+
+func TestNewFileReporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.jsonl")
+	b, err := NewFileReporter(path, BatchOptions{Size: 1})
+	testutil.Ok(t, err)
+	b.Report(Report{Message: "db down"})
+	b.Report(Report{Message: "panic: boom"})
+	b.Close()
+
+	f, err := os.Open(path)
+	testutil.Ok(t, err)
+	defer f.Close()
+
+	var messages []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var r Report
+		testutil.Ok(t, json.Unmarshal(s.Bytes(), &r))
+		messages = append(messages, r.Message)
+	}
+	testutil.Equals(t, []string{"db down", "panic: boom"}, messages)
+
+	_, err = NewFileReporter(filepath.Join(path, "nope"), BatchOptions{})
+	testutil.Asserts(t, err != nil, "unwritable path should fail")
+}
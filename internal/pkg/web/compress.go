@@ -0,0 +1,172 @@
+package web
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder wraps w so that what is written to it is compressed with a content coding
+type Encoder func(w io.Writer) (io.WriteCloser, error)
+
+type registeredEncoder struct {
+	coding string
+	encode Encoder
+}
+
+var (
+	encodersMu sync.RWMutex
+	// encoders is in order of preference, when the client likes some codings equally
+	encoders = []registeredEncoder{
+		{coding: "gzip", encode: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+		}},
+		{coding: "deflate", encode: func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, flate.DefaultCompression)
+		}},
+	}
+)
+
+// RegisterEncoder makes Compress able to use the content coding, e.g. "br", in preference
+// to the ones already registered. gzip and deflate are registered by default
+func RegisterEncoder(coding string, e Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	coding = strings.ToLower(coding)
+	registered := []registeredEncoder{{coding: coding, encode: e}}
+	for _, re := range encoders {
+		if re.coding != coding {
+			registered = append(registered, re)
+		}
+	}
+	encoders = registered
+}
+
+// CompressionOptions configures Compress
+type CompressionOptions struct {
+	// MinSize is the size in bytes under which responses are not worth compressing
+	MinSize int
+}
+
+// Compress compresses the responses with the best content coding accepted by the client.
+// The ETag of a compressed response is suffixed with the coding, e.g. "abc-gzip", as it is
+// a different representation; the suffix is removed from If-None-Match before passing the
+// request on, so that it still works with Conditional
+func Compress(opts CompressionOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			coding, encode := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encode == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			inm := r.Header.Get("If-None-Match")
+			if inm != "" {
+				r.Header.Set("If-None-Match", stripETagSuffix(inm, coding))
+			}
+
+			bw := newBufferedWriter(w)
+			next.ServeHTTP(bw, r)
+
+			h := w.Header()
+			switch {
+			case bw.status == http.StatusNotModified:
+				// the client has the compressed representation if it sent back its ETag
+				if etag := h.Get("ETag"); etag != "" && strings.Contains(inm, suffixETag(etag, coding)) {
+					h.Set("ETag", suffixETag(etag, coding))
+				}
+				bw.flush()
+				return
+			case bw.buf.Len() < opts.MinSize, h.Get("Content-Encoding") != "", bw.status == http.StatusNoContent:
+				bw.flush()
+				return
+			}
+
+			var compressed bytes.Buffer
+			ew, err := encode(&compressed)
+			if err == nil {
+				_, err = ew.Write(bw.buf.Bytes())
+			}
+			if err == nil {
+				err = ew.Close()
+			}
+			if err != nil {
+				// sending it as is beats failing the request
+				bw.flush()
+				return
+			}
+
+			h.Set("Content-Encoding", coding)
+			h.Del("Content-Length")
+			if etag := h.Get("ETag"); etag != "" {
+				h.Set("ETag", suffixETag(etag, coding))
+			}
+			w.WriteHeader(bw.status)
+			_, _ = w.Write(compressed.Bytes())
+		})
+	}
+}
+
+// negotiateEncoding picks the registered coding with the highest q-value in Accept-Encoding
+func negotiateEncoding(header string) (string, Encoder) {
+	if header == "" {
+		return "", nil
+	}
+
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[coding] = q
+	}
+
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	var best registeredEncoder
+	bestQ := 0.0
+	for _, re := range encoders {
+		q, ok := accepted[re.coding]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = re, q
+		}
+	}
+	return best.coding, best.encode
+}
+
+// suffixETag turns "abc" into "abc-gzip" and W/"abc" into W/"abc-gzip"
+func suffixETag(etag, coding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + coding + `"`
+}
+
+// stripETagSuffix removes the suffix added by suffixETag from every tag of an If-None-Match header
+func stripETagSuffix(header, coding string) string {
+	return strings.Replace(header, "-"+coding+`"`, `"`, -1)
+}
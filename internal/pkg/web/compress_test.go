@@ -0,0 +1,124 @@
+package web
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "identity", want: ""},
+		{header: "gzip", want: "gzip"},
+		{header: "deflate, gzip", want: "gzip"},
+		{header: "gzip;q=0.5, deflate", want: "deflate"},
+		{header: "GZIP;q=0.8, deflate;q=0.2", want: "gzip"},
+		{header: "br, *;q=0.1", want: "gzip"},
+		{header: "gzip;q=0, *", want: "deflate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, _ := negotiateEncoding(tt.header)
+			testutil.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	long := strings.Repeat("Daredevil is some broke lawyer. ", 100)
+	handler := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			RespondJSON(r.Context(), w, body, nil)
+		})
+	}
+
+	tests := []struct {
+		name         string
+		body         string
+		acceptEnc    string
+		wantEncoding string
+	}{
+		{
+			name:         "gzip",
+			body:         long,
+			acceptEnc:    "gzip, deflate",
+			wantEncoding: "gzip",
+		},
+		{
+			name:         "too small",
+			body:         "Daredevil",
+			acceptEnc:    "gzip",
+			wantEncoding: "",
+		},
+		{
+			name:         "not accepted",
+			body:         long,
+			acceptEnc:    "",
+			wantEncoding: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/characters", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEnc)
+			rr := httptest.NewRecorder()
+			Compress(CompressionOptions{MinSize: 1024})(handler(tt.body)).ServeHTTP(rr, req)
+
+			testutil.Equals(t, http.StatusOK, rr.Code)
+			testutil.Equals(t, "Accept-Encoding", rr.Header().Get("Vary"))
+			testutil.Equals(t, tt.wantEncoding, rr.Header().Get("Content-Encoding"))
+			testutil.Equals(t, "application/json", rr.Header().Get("Content-Type"))
+
+			body := rr.Body.String()
+			if tt.wantEncoding == "gzip" {
+				gr, err := gzip.NewReader(rr.Body)
+				testutil.Ok(t, err)
+				b, err := ioutil.ReadAll(gr)
+				testutil.Ok(t, err)
+				body = string(b)
+			}
+			testutil.Equals(t, `"`+tt.body+`"`, body)
+		})
+	}
+}
+
+func TestCompress_conditional(t *testing.T) {
+	long := strings.Repeat("Daredevil is some broke lawyer. ", 100)
+	h := Compress(CompressionOptions{MinSize: 1024})(Conditional(CachingOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondJSON(r.Context(), w, long, nil)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/characters", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	testutil.Equals(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	testutil.Asserts(t, strings.HasSuffix(etag, `-gzip"`), "etag %s should carry the coding", etag)
+
+	req = httptest.NewRequest(http.MethodGet, "/characters", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	testutil.Equals(t, http.StatusNotModified, rr.Code)
+	testutil.Equals(t, etag, rr.Header().Get("ETag"))
+	testutil.Equals(t, "", rr.Header().Get("Content-Encoding"))
+	testutil.Equals(t, "", rr.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/characters", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	testutil.Equals(t, http.StatusOK, rr.Code)
+	testutil.Equals(t, strongETag([]byte(`"`+long+`"`)), rr.Header().Get("ETag"))
+}
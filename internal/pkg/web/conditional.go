@@ -0,0 +1,159 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+)
+
+// CachingOptions configures the caching headers set by Conditional
+type CachingOptions struct {
+	// CacheControl is the value of the Cache-Control header, it is not set if empty
+	CacheControl string
+	// LastModified returns when the served data last changed, Last-Modified is not set if nil or zero
+	LastModified func(ctx context.Context) (time.Time, error)
+	// Private is set when the responses depend on the credentials of the request, CacheControl is then
+	// made private so that shared caches, e.g. CDNs, never serve them to someone else
+	Private bool
+}
+
+// Conditional sets ETag, Last-Modified and Cache-Control on successful GET and HEAD
+// responses, and answers 304 Not Modified should the client already have the response.
+// A Cache-Control set by the handler is kept
+func Conditional(opts CachingOptions) func(http.Handler) http.Handler {
+	cacheControl := opts.CacheControl
+	if opts.Private {
+		cacheControl = privateCacheControl(cacheControl)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			bw := newBufferedWriter(w)
+			next.ServeHTTP(bw, r)
+			if bw.status != http.StatusOK {
+				bw.flush()
+				return
+			}
+
+			etag := strongETag(bw.buf.Bytes())
+			h := w.Header()
+			h.Set("ETag", etag)
+			if cacheControl != "" && h.Get("Cache-Control") == "" {
+				h.Set("Cache-Control", cacheControl)
+			}
+
+			var lastModified time.Time
+			if opts.LastModified != nil {
+				t, err := opts.LastModified(r.Context())
+				if err != nil {
+					loglib.GetLogger(r.Context()).ErrorF("[Web conditional] last modified error: %s", err)
+				}
+				lastModified = t
+			}
+			if !lastModified.IsZero() {
+				h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+			}
+
+			if notModified(r, etag, lastModified) {
+				h.Del("Content-Type")
+				h.Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			bw.flush()
+		})
+	}
+}
+
+// privateCacheControl replaces public with private in the Cache-Control directives, adding it if need be
+func privateCacheControl(cc string) string {
+	directives := []string{"private"}
+	for _, d := range strings.Split(cc, ",") {
+		d = strings.TrimSpace(d)
+		switch strings.ToLower(d) {
+		case "", "public", "private":
+			continue
+		}
+		directives = append(directives, d)
+	}
+	return strings.Join(directives, ",")
+}
+
+// strongETag returns a strong entity tag of the body
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified evaluates If-None-Match, and If-Modified-Since only when the former is absent, per RFC 7232
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(t)
+}
+
+// etagMatches uses the weak comparison, which is the one to use for If-None-Match
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter holds the response back so that it can be inspected before being written
+type bufferedWriter struct {
+	w           http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func newBufferedWriter(w http.ResponseWriter) *bufferedWriter {
+	return &bufferedWriter{w: w, status: http.StatusOK}
+}
+
+func (b *bufferedWriter) Header() http.Header {
+	return b.w.Header()
+}
+
+func (b *bufferedWriter) WriteHeader(status int) {
+	if b.wroteHeader {
+		return
+	}
+	b.status = status
+	b.wroteHeader = true
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+// flush writes the held back response
+func (b *bufferedWriter) flush() {
+	b.w.WriteHeader(b.status)
+	_, _ = b.w.Write(b.buf.Bytes())
+}
@@ -0,0 +1,185 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestConditional(t *testing.T) {
+	synced := time.Date(2021, time.March, 3, 10, 0, 0, 500, time.UTC)
+	body := `[391264,831256]`
+	etag := strongETag([]byte(body))
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondJSON(r.Context(), w, []int{391264, 831256}, nil)
+	})
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondJSON(r.Context(), w, &Error{Status: http.StatusNotFound, Code: "no_such_character", Desc: "no such character"}, nil)
+	})
+
+	tests := []struct {
+		name             string
+		handler          http.Handler
+		method           string
+		reqHeaders       map[string]string
+		private          bool
+		lastModified     func(ctx context.Context) (time.Time, error)
+		wantStatus       int
+		wantBody         string
+		wantETag         string
+		wantLastModified string
+		wantCacheControl string
+	}{
+		{
+			name:             "first request",
+			handler:          ok,
+			method:           http.MethodGet,
+			lastModified:     func(ctx context.Context) (time.Time, error) { return synced, nil },
+			wantStatus:       http.StatusOK,
+			wantBody:         body,
+			wantETag:         etag,
+			wantLastModified: "Wed, 03 Mar 2021 10:00:00 GMT",
+			wantCacheControl: "public,max-age=60",
+		},
+		{
+			name:             "matching etag",
+			handler:          ok,
+			method:           http.MethodGet,
+			reqHeaders:       map[string]string{"If-None-Match": `"other", ` + etag},
+			lastModified:     func(ctx context.Context) (time.Time, error) { return synced, nil },
+			wantStatus:       http.StatusNotModified,
+			wantETag:         etag,
+			wantLastModified: "Wed, 03 Mar 2021 10:00:00 GMT",
+			wantCacheControl: "public,max-age=60",
+		},
+		{
+			name:             "weak matching etag",
+			handler:          ok,
+			method:           http.MethodHead,
+			reqHeaders:       map[string]string{"If-None-Match": "W/" + etag},
+			wantStatus:       http.StatusNotModified,
+			wantETag:         etag,
+			wantCacheControl: "public,max-age=60",
+		},
+		{
+			name:             "stale etag wins over if-modified-since",
+			handler:          ok,
+			method:           http.MethodGet,
+			reqHeaders:       map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": "Wed, 03 Mar 2021 10:00:00 GMT"},
+			lastModified:     func(ctx context.Context) (time.Time, error) { return synced, nil },
+			wantStatus:       http.StatusOK,
+			wantBody:         body,
+			wantETag:         etag,
+			wantLastModified: "Wed, 03 Mar 2021 10:00:00 GMT",
+			wantCacheControl: "public,max-age=60",
+		},
+		{
+			name:             "not modified since",
+			handler:          ok,
+			method:           http.MethodGet,
+			reqHeaders:       map[string]string{"If-Modified-Since": "Wed, 03 Mar 2021 10:00:00 GMT"},
+			lastModified:     func(ctx context.Context) (time.Time, error) { return synced, nil },
+			wantStatus:       http.StatusNotModified,
+			wantETag:         etag,
+			wantLastModified: "Wed, 03 Mar 2021 10:00:00 GMT",
+			wantCacheControl: "public,max-age=60",
+		},
+		{
+			name:             "modified since",
+			handler:          ok,
+			method:           http.MethodGet,
+			reqHeaders:       map[string]string{"If-Modified-Since": "Wed, 03 Mar 2021 09:59:59 GMT"},
+			lastModified:     func(ctx context.Context) (time.Time, error) { return synced, nil },
+			wantStatus:       http.StatusOK,
+			wantBody:         body,
+			wantETag:         etag,
+			wantLastModified: "Wed, 03 Mar 2021 10:00:00 GMT",
+			wantCacheControl: "public,max-age=60",
+		},
+		{
+			name:             "last modified unknown",
+			handler:          ok,
+			method:           http.MethodGet,
+			reqHeaders:       map[string]string{"If-Modified-Since": "Wed, 03 Mar 2021 10:00:00 GMT"},
+			lastModified:     func(ctx context.Context) (time.Time, error) { return time.Time{}, errors.New("db down") },
+			wantStatus:       http.StatusOK,
+			wantBody:         body,
+			wantETag:         etag,
+			wantCacheControl: "public,max-age=60",
+		},
+		{
+			name:             "private",
+			handler:          ok,
+			method:           http.MethodGet,
+			private:          true,
+			wantStatus:       http.StatusOK,
+			wantBody:         body,
+			wantETag:         etag,
+			wantCacheControl: "private,max-age=60",
+		},
+		{
+			name: "cache control of the handler kept",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "no-store")
+				RespondJSON(r.Context(), w, []int{391264, 831256}, nil)
+			}),
+			method:           http.MethodGet,
+			wantStatus:       http.StatusOK,
+			wantBody:         body,
+			wantETag:         etag,
+			wantCacheControl: "no-store",
+		},
+		{
+			name:       "errors are left alone",
+			handler:    notFound,
+			method:     http.MethodGet,
+			reqHeaders: map[string]string{"If-None-Match": "*"},
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"error":"no_such_character","error_description":"no such character"}`,
+		},
+		{
+			name:       "other methods are left alone",
+			handler:    ok,
+			method:     http.MethodPost,
+			reqHeaders: map[string]string{"If-None-Match": etag},
+			wantStatus: http.StatusOK,
+			wantBody:   body,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/characters", nil)
+			for k, v := range tt.reqHeaders {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			h := Conditional(CachingOptions{CacheControl: "public,max-age=60", LastModified: tt.lastModified, Private: tt.private})(tt.handler)
+			h.ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantBody, rr.Body.String())
+			testutil.Equals(t, tt.wantETag, rr.Header().Get("ETag"))
+			testutil.Equals(t, tt.wantLastModified, rr.Header().Get("Last-Modified"))
+			testutil.Equals(t, tt.wantCacheControl, rr.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestPrivateCacheControl(t *testing.T) {
+	tests := map[string]string{
+		"":                              "private",
+		"public,max-age=60":             "private,max-age=60",
+		"max-age=60, Public":            "private,max-age=60",
+		"private, no-cache":             "private,no-cache",
+		"public, max-age=60, immutable": "private,max-age=60,immutable",
+	}
+	for cc, want := range tests {
+		testutil.Equals(t, want, privateCacheControl(cc))
+	}
+}
@@ -6,7 +6,8 @@ import (
 	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
 )
 
-// ReportError handles reporting of standard and Error errors
+// ReportError handles reporting of standard and Error errors, logging them and giving them
+// to the reporters registered with RegisterReporter
 func ReportError(err error, r *http.Request) {
 	if err == nil {
 		return
@@ -14,8 +15,8 @@ func ReportError(err error, r *http.Request) {
 
 	logger := loglib.GetLogger(r.Context())
 
-	logger.ErrorF(err.Error())
-	// additional error reporting if necessary
+	logger.ErrorF("%s", Cause(err))
+	report(newReport(err, r))
 }
 
 // ReportErrorWrapper provides wrapper implementation to HandlerFunc for reporting Error
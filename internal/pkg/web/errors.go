@@ -2,6 +2,7 @@ package web
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -13,24 +14,64 @@ type Error struct {
 	Code   string `json:"error"`
 	Desc   string `json:"error_description"`
 	Err    error  `json:"-"`
+	// Headers are set on the response, e.g. Retry-After
+	Headers map[string]string `json:"-"`
+	// InvalidParams lists what is wrong with each field of the request, e.g. query parameters
+	InvalidParams []FieldError `json:"invalid_params,omitempty"`
+	// Type is the URI of the problem type in problem details, about:blank if empty
+	Type string `json:"-"`
+	// Extensions are the additional members of problem details
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// FieldError is a problem with a field of the request
+type FieldError struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// NewValidationError returns a 400 Error listing the problems with the fields of the request
+func NewValidationError(fields ...FieldError) *Error {
+	reasons := make([]string, len(fields))
+	for i, f := range fields {
+		reasons[i] = f.Name + ": " + f.Reason
+	}
+	return &Error{
+		Status:        http.StatusBadRequest,
+		Code:          "invalid_params",
+		Desc:          "invalid parameters, " + strings.Join(reasons, "; "),
+		InvalidParams: fields,
+	}
 }
 
 func (e Error) Error() string {
 	return e.Desc
 }
 
-// TypecastError performs a type assertion on the provide `error` and returns the object if concrete type is `Error`
-func TypecastError(err error) *Error {
-	if err == nil {
-		return nil
-	}
+// Unwrap returns the cause of the Error, if any
+func (e Error) Unwrap() error {
+	return e.Err
+}
 
-	if webErr, ok := err.(*Error); ok {
+// TypecastError returns the first `Error` in the chain of the provided `error`, if any,
+// so that an `Error` wrapped by fmt.Errorf("%w") or pkg/errors is still found
+func TypecastError(err error) *Error {
+	var webErr *Error
+	if errors.As(err, &webErr) {
 		return webErr
 	}
 	return nil
 }
 
+// Cause returns the description of err followed by the chain of its causes, for logging
+func Cause(err error) string {
+	webErr := TypecastError(err)
+	if webErr == nil || webErr.Err == nil || webErr.Err.Error() == webErr.Desc {
+		return err.Error()
+	}
+	return err.Error() + ": " + webErr.Err.Error()
+}
+
 // WithStack adds stack trace into the Error object
 func WithStack(err error) *Error {
 	webErr := TypecastError(err)
@@ -43,7 +84,7 @@ func WithStack(err error) *Error {
 	return webErr
 }
 
-// NewError returns a new Error object based on the provided err and message
+// NewError returns a new Error object based on the provided err and message, keeping err as its cause
 func NewError(err error, message string) *Error {
 	var result *Error
 	webErr := TypecastError(err)
@@ -56,7 +97,7 @@ func NewError(err error, message string) *Error {
 	} else {
 		result = &Error{Status: http.StatusInternalServerError, Code: "internal_error", Desc: message}
 	}
-	result.Err = errors.WithStack(errors.New(message))
+	result.Err = errors.WithStack(err)
 	return result
 }
 
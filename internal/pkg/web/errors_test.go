@@ -2,10 +2,12 @@ package web
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"testing"
 
 	"github.com/kagelui/marvel-forwarder/internal/testutil"
+	pkgerrors "github.com/pkg/errors"
 )
 
 func TestWithStack(t *testing.T) {
@@ -57,3 +59,61 @@ func TestNewError(t *testing.T) {
 		})
 	}
 }
+
+func TestTypecastError_wrapped(t *testing.T) {
+	notFound := &Error{Status: http.StatusNotFound, Code: "no_such_character", Desc: "no such character"}
+	testCases := []struct {
+		name  string
+		given error
+		want  *Error
+	}{
+		{"nil", nil, nil},
+		{"not a web error", errors.New("db down"), nil},
+		{"web error", notFound, notFound},
+		{"wrapped by fmt", fmt.Errorf("fetching character: %w", notFound), notFound},
+		{"wrapped by pkg/errors", pkgerrors.Wrap(notFound, "fetching character"), notFound},
+		{"wrapped twice", fmt.Errorf("handler: %w", pkgerrors.WithStack(notFound)), notFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.Asserts(t, TypecastError(tc.given) == tc.want, "should be %v, got %v", tc.want, TypecastError(tc.given))
+		})
+	}
+}
+
+func TestNewError_cause(t *testing.T) {
+	errDBDown := errors.New("db down")
+	result := NewError(fmt.Errorf("getting character: %w", errDBDown), "character error")
+
+	testutil.Asserts(t, errors.Is(result, errDBDown), "cause should be kept")
+	testutil.Equals(t, "character error", result.Error())
+	testutil.Equals(t, "character error: getting character: db down", Cause(result))
+
+	notFound := &Error{Status: http.StatusNotFound, Code: "no_such_character", Desc: "no such character"}
+	result = NewError(fmt.Errorf("fetching: %w", notFound), "custom message")
+	testutil.Equals(t, http.StatusNotFound, result.Status)
+	testutil.Equals(t, "no_such_character", result.Code)
+	testutil.Equals(t, "custom message", result.Desc)
+	var webErr *Error
+	testutil.Asserts(t, errors.As(result.Err, &webErr) && webErr == notFound, "cause should be kept")
+}
+
+func TestCause(t *testing.T) {
+	testCases := []struct {
+		name  string
+		given error
+		want  string
+	}{
+		{"plain", errors.New("db down"), "db down"},
+		{"web error without cause", &Error{Desc: "no such character"}, "no such character"},
+		{"web error with cause", &Error{Desc: "character error", Err: errors.New("db down")}, "character error: db down"},
+		{"web error from WithStack", WithStack(&Error{Desc: "no such character"}), "no such character"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.Equals(t, tc.want, Cause(tc.given))
+		})
+	}
+}
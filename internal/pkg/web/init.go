@@ -25,6 +25,6 @@ type Handler struct {
 
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err := h.H(w, r); err != nil {
-		RespondJSON(r.Context(), w, err, nil)
+		RespondError(w, r, err)
 	}
 }
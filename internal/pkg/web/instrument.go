@@ -0,0 +1,56 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/metrics"
+)
+
+// unmatchedRoute is the route label of requests matching no route, so that paths do not become labels
+const unmatchedRoute = "unmatched"
+
+var (
+	requestsTotal = metrics.NewCounter("http_requests_total",
+		"HTTP requests served, per route, method and status.", "route", "method", "status")
+	requestDuration = metrics.NewHistogram("http_request_duration_seconds",
+		"Latency of the HTTP requests, per route, method and status.", metrics.DefBuckets, "route", "method", "status")
+	requestsAborted = metrics.NewCounter("http_requests_aborted_total",
+		"HTTP responses cut short by a panic, e.g. http.ErrAbortHandler, per route and method.", "route", "method")
+)
+
+// InstrumentOptions configures Instrument
+type InstrumentOptions struct {
+	// Route returns the route template matched by the request, e.g. /characters/{id}, if any
+	Route func(r *http.Request) string
+}
+
+// Instrument counts and times the requests per route, method and status in metrics.Default, the
+// requests aborted by a panic being counted as well before it is panicked again
+func Instrument(opts InstrumentOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			route := unmatchedRoute
+			if opts.Route != nil {
+				if matched := opts.Route(r); matched != "" {
+					route = matched
+				}
+			}
+
+			rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				v := recover()
+				status := strconv.Itoa(rw.status)
+				requestsTotal.Inc(route, r.Method, status)
+				requestDuration.ObserveSince(start, route, r.Method, status)
+				if v != nil {
+					requestsAborted.Inc(route, r.Method)
+					panic(v)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/metrics"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestInstrument(t *testing.T) {
+	h := Instrument(InstrumentOptions{
+		Route: func(r *http.Request) string {
+			if r.URL.Path == "/characters/1009610" {
+				return "/characters/{id}"
+			}
+			return ""
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/characters/1009610" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	for _, path := range []string{"/characters/1009610", "/characters/1009610", "/nope"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	var buf bytes.Buffer
+	testutil.Ok(t, metrics.Default.WriteText(&buf))
+	for _, want := range []string{
+		`http_requests_total{route="/characters/{id}",method="GET",status="200"} 2`,
+		`http_requests_total{route="unmatched",method="GET",status="404"} 1`,
+		`http_request_duration_seconds_count{route="/characters/{id}",method="GET",status="200"} 2`,
+	} {
+		testutil.Asserts(t, bytes.Contains(buf.Bytes(), []byte(want)), "should contain %s, got %s", want, buf.String())
+	}
+}
+
+func TestInstrument_aborted(t *testing.T) {
+	h := Instrument(InstrumentOptions{
+		Route: func(r *http.Request) string { return "/export/characters" },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("cut"))
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		v := recover()
+		testutil.Asserts(t, v == http.ErrAbortHandler, "the abort should be panicked again, got %v", v)
+
+		var buf bytes.Buffer
+		testutil.Ok(t, metrics.Default.WriteText(&buf))
+		for _, want := range []string{
+			`http_requests_total{route="/export/characters",method="GET",status="200"} 1`,
+			`http_requests_aborted_total{route="/export/characters",method="GET"} 1`,
+		} {
+			testutil.Asserts(t, bytes.Contains(buf.Bytes(), []byte(want)), "should contain %s, got %s", want, buf.String())
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/export/characters", nil))
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+)
+
+// ProblemContentType is the media type of the problem details of RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// RespondError writes err as problem details should the client prefer them to JSON,
+// else as JSON, i.e. {"error": ..., "error_description": ...}. Errors other than Error,
+// wrapping one or not, are 500 Internal Server Error either way
+func RespondError(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Add("Vary", "Accept")
+	if !prefersProblem(r.Header.Get("Accept")) {
+		webErr := TypecastError(err)
+		if webErr == nil {
+			webErr = WithStack(err)
+		}
+		RespondJSON(r.Context(), w, webErr, nil)
+		return
+	}
+	RespondProblem(w, r, err)
+}
+
+// RespondProblem writes err as problem details, errors other than Error being 500 Internal Server Error
+func RespondProblem(w http.ResponseWriter, r *http.Request, err error) {
+	logger := loglib.GetLogger(r.Context())
+
+	webErr := TypecastError(err)
+	if webErr == nil {
+		webErr = WithStack(err)
+	}
+	logger.ErrorF("[Web responder] Web error: %d %s %s", webErr.Status, webErr.Code, webErr.Desc)
+
+	problem := make(map[string]interface{}, len(webErr.Extensions)+8)
+	for k, v := range webErr.Extensions {
+		problem[k] = v
+	}
+
+	problemType := webErr.Type
+	if problemType == "" {
+		problemType = "about:blank"
+	}
+	detail := webErr.Desc
+	// 5XX (except 503) should be sanitized before showing to human
+	if webErr.Status >= 500 && webErr.Status != http.StatusServiceUnavailable {
+		detail = GenericErrorMessage
+	}
+	problem["type"] = problemType
+	problem["title"] = http.StatusText(webErr.Status)
+	problem["status"] = webErr.Status
+	problem["detail"] = detail
+	problem["instance"] = r.URL.RequestURI()
+	problem["code"] = webErr.Code
+	if len(webErr.InvalidParams) > 0 {
+		problem["invalid_params"] = webErr.InvalidParams
+	}
+	if id, ok := RequestIDFromContext(r.Context()); ok {
+		problem["request_id"] = id
+	}
+
+	respBytes, marshalErr := json.Marshal(problem)
+	if marshalErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logger.ErrorF("[Web responder] JSON marshal error: %s", marshalErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	for key, value := range webErr.Headers {
+		w.Header().Set(key, value)
+	}
+
+	logger.WithField("error", "true").WithField("status", webErr.Status).
+		InfoF("[Web responder] Wrote %d bytes", len(respBytes))
+
+	w.WriteHeader(webErr.Status)
+	_, _ = w.Write(respBytes)
+}
+
+// prefersProblem tells whether the Accept header ranks problem details at least as high as JSON
+func prefersProblem(accept string) bool {
+	if accept == "" {
+		return false
+	}
+
+	problemQ, jsonQ := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case ProblemContentType:
+			problemQ = q
+		case "application/json":
+			jsonQ = q
+		}
+	}
+	return problemQ > 0 && problemQ >= jsonQ
+}
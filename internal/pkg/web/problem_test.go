@@ -0,0 +1,127 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestRespondError(t *testing.T) {
+	invalid := NewValidationError(
+		FieldError{Name: "limit", Reason: "must be between 1 and 100"},
+		FieldError{Name: "orderBy", Reason: "unknown field nickname"},
+	)
+	invalid.Type = "https://marvel-forwarder.example/problems/invalid-params"
+	invalid.Extensions = map[string]interface{}{"status": 418, "docs": "/docs#characters"}
+
+	tests := []struct {
+		name            string
+		accept          string
+		err             error
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "legacy by default",
+			err:             &Error{Status: http.StatusNotFound, Code: "no_such_character", Desc: "no such character"},
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/json",
+			wantBody:        `{"error":"no_such_character","error_description":"no such character"}`,
+		},
+		{
+			name:            "legacy preferred",
+			accept:          "application/json, application/problem+json;q=0.5",
+			err:             &Error{Status: http.StatusNotFound, Code: "no_such_character", Desc: "no such character"},
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/json",
+			wantBody:        `{"error":"no_such_character","error_description":"no such character"}`,
+		},
+		{
+			name:            "legacy with invalid params",
+			err:             NewValidationError(FieldError{Name: "limit", Reason: "must be a number"}),
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "application/json",
+			wantBody:        `{"error":"invalid_params","error_description":"invalid parameters, limit: must be a number","invalid_params":[{"name":"limit","reason":"must be a number"}]}`,
+		},
+		{
+			name:            "legacy wrapped",
+			err:             fmt.Errorf("character lookup: %w", &Error{Status: http.StatusNotFound, Code: "no_such_character", Desc: "no such character"}),
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/json",
+			wantBody:        `{"error":"no_such_character","error_description":"no such character"}`,
+		},
+		{
+			name:            "legacy sanitized",
+			err:             errors.New("db down"),
+			wantStatus:      http.StatusInternalServerError,
+			wantContentType: "application/json",
+			wantBody:        `{"error":"internal_error","error_description":"Sorry, there was a problem. Please try again later."}`,
+		},
+		{
+			name:            "problem",
+			accept:          "application/problem+json",
+			err:             &Error{Status: http.StatusNotFound, Code: "no_such_character", Desc: "no such character"},
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/problem+json",
+			wantBody:        `{"code":"no_such_character","detail":"no such character","instance":"/characters/1?api_key=x","request_id":"c0ffee","status":404,"title":"Not Found","type":"about:blank"}`,
+		},
+		{
+			name:            "problem with invalid params and extensions",
+			accept:          "application/json;q=0.9, application/problem+json",
+			err:             invalid,
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "application/problem+json",
+			wantBody:        `{"code":"invalid_params","detail":"invalid parameters, limit: must be between 1 and 100; orderBy: unknown field nickname","docs":"/docs#characters","instance":"/characters/1?api_key=x","invalid_params":[{"name":"limit","reason":"must be between 1 and 100"},{"name":"orderBy","reason":"unknown field nickname"}],"request_id":"c0ffee","status":400,"title":"Bad Request","type":"https://marvel-forwarder.example/problems/invalid-params"}`,
+		},
+		{
+			name:            "problem sanitized",
+			accept:          "application/problem+json",
+			err:             errors.New("db down"),
+			wantStatus:      http.StatusInternalServerError,
+			wantContentType: "application/problem+json",
+			wantBody:        `{"code":"internal_error","detail":"Sorry, there was a problem. Please try again later.","instance":"/characters/1?api_key=x","request_id":"c0ffee","status":500,"title":"Internal Server Error","type":"about:blank"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/characters/1?api_key=x", nil)
+			req = req.WithContext(context.WithValue(req.Context(), requestIDContextKey{}, "c0ffee"))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			RespondError(rr, req, tt.err)
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantContentType, rr.Header().Get("Content-Type"))
+			testutil.Equals(t, "Accept", rr.Header().Get("Vary"))
+			testutil.Equals(t, tt.wantBody, rr.Body.String())
+		})
+	}
+}
+
+func TestPrefersProblem(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "*/*", want: false},
+		{accept: "application/json", want: false},
+		{accept: "application/problem+json", want: true},
+		{accept: "application/problem+json;q=0", want: false},
+		{accept: "application/json;q=0.8, application/problem+json;q=0.8", want: true},
+		{accept: "application/json, application/problem+json;q=0.8", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			testutil.Equals(t, tt.want, prefersProblem(tt.accept))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+)
+
+// PanicError is a recovered panic with the stack trace of the goroutine which panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// RecoverWrapper turns a panic of the next HandlerFunc into a 500 Error, logging and reporting its stack trace.
+// http.ErrAbortHandler is panicked again, as it is meant to abort the response
+func RecoverWrapper() HandlerWrapper {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) (err error) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				perr := PanicError{Value: v, Stack: debug.Stack()}
+				loglib.GetLogger(r.Context()).
+					WithField("stack", string(perr.Stack)).
+					ErrorF("[Web recover] %s", perr)
+
+				webErr := &Error{
+					Status: http.StatusInternalServerError,
+					Code:   "internal_error",
+					Desc:   perr.Error(),
+					Err:    perr,
+				}
+				ReportError(webErr, r)
+				err = webErr
+			}()
+			return next(w, r)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestRecoverWrapper(t *testing.T) {
+	tests := []struct {
+		name       string
+		h          HandlerFunc
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "panic",
+			h: func(w http.ResponseWriter, r *http.Request) error {
+				var m map[string]int
+				m["daredevil"]++
+				return nil
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"internal_error","error_description":"Sorry, there was a problem. Please try again later."}`,
+		},
+		{
+			name: "error",
+			h: func(w http.ResponseWriter, r *http.Request) error {
+				return &Error{Status: http.StatusNotFound, Code: "no_such_character", Desc: "no such character"}
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"error":"no_such_character","error_description":"no such character"}`,
+		},
+		{
+			name: "no panic",
+			h: func(w http.ResponseWriter, r *http.Request) error {
+				RespondJSON(r.Context(), w, "ok", nil)
+				return nil
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"ok"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			Handler{H: Wrap(tt.h, RecoverWrapper())}.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/characters", nil))
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantBody, rr.Body.String())
+		})
+	}
+}
+
+func TestRecoverWrapper_stack(t *testing.T) {
+	h := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		panic("boom")
+	}, RecoverWrapper())
+
+	err := h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/characters", nil))
+	webErr := TypecastError(err)
+	testutil.Asserts(t, webErr != nil, "should be a web error")
+	perr, ok := webErr.Err.(PanicError)
+	testutil.Asserts(t, ok, "should keep the panic")
+	testutil.Equals(t, "boom", perr.Value)
+	testutil.Asserts(t, strings.Contains(string(perr.Stack), "TestRecoverWrapper_stack"), "stack should lead to the panic")
+}
+
+func TestRecoverWrapper_abort(t *testing.T) {
+	h := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		panic(http.ErrAbortHandler)
+	}, RecoverWrapper())
+
+	defer func() {
+		testutil.Asserts(t, recover() == http.ErrAbortHandler, "should panic with http.ErrAbortHandler")
+	}()
+	_ = h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/characters", nil))
+	t.Fatal("should panic again")
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Report is an error reported by ReportError, with the request it occurred in
+type Report struct {
+	Time      time.Time `json:"time"`
+	Status    int       `json:"status"`
+	Code      string    `json:"code"`
+	Message   string    `json:"message"`
+	Stack     string    `json:"stack,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// Reporter sends reports somewhere, Report is called while serving the request so it must not block
+type Reporter interface {
+	Report(r Report)
+}
+
+// ReporterOptions configures which reports a registered Reporter is given
+type ReporterOptions struct {
+	// MinStatus is the lowest status reported, 500 if zero
+	MinStatus int
+	// SampleRate is the share of the reports given, from 0 exclusive to 1. All are given if zero
+	SampleRate float64
+}
+
+type registeredReporter struct {
+	reporter Reporter
+	opts     ReporterOptions
+}
+
+var (
+	reportersMu sync.RWMutex
+	reporters   []registeredReporter
+	// sample returns a number in [0, 1), it is replaced by tests
+	sample = rand.Float64
+)
+
+// RegisterReporter makes ReportError give the reports selected by opts to r
+func RegisterReporter(r Reporter, opts ReporterOptions) {
+	if opts.MinStatus == 0 {
+		opts.MinStatus = http.StatusInternalServerError
+	}
+	if opts.SampleRate == 0 {
+		opts.SampleRate = 1
+	}
+
+	reportersMu.Lock()
+	defer reportersMu.Unlock()
+	reporters = append(reporters, registeredReporter{reporter: r, opts: opts})
+}
+
+// report gives the report to the registered reporters selecting it
+func report(rep Report) {
+	reportersMu.RLock()
+	defer reportersMu.RUnlock()
+
+	for _, rr := range reporters {
+		if rep.Status < rr.opts.MinStatus {
+			continue
+		}
+		if rr.opts.SampleRate < 1 && sample() >= rr.opts.SampleRate {
+			continue
+		}
+		rr.reporter.Report(rep)
+	}
+}
+
+// newReport describes err, the stack being the one captured by WithStack, NewError or errors.WithStack
+func newReport(err error, r *http.Request) Report {
+	rep := Report{
+		Time:      time.Now().UTC(),
+		Status:    http.StatusInternalServerError,
+		Code:      "internal_error",
+		Message:   Cause(err),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		ClientIP:  clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	rep.RequestID, _ = RequestIDFromContext(r.Context())
+
+	cause := err
+	if webErr := TypecastError(err); webErr != nil {
+		rep.Status, rep.Code = webErr.Status, webErr.Code
+		if webErr.Err != nil {
+			cause = webErr.Err
+		}
+	}
+	rep.Stack = stackOf(cause)
+	return rep
+}
+
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+func stackOf(err error) string {
+	var perr PanicError
+	if errors.As(err, &perr) {
+		return string(perr.Stack)
+	}
+	var st stackTracer
+	if errors.As(err, &st) {
+		return fmt.Sprintf("%+v", st.StackTrace())
+	}
+	return ""
+}
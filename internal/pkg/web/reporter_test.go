@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+type mockReporter struct {
+	mu      sync.Mutex
+	reports []Report
+}
+
+func (m *mockReporter) Report(r Report) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reports = append(m.reports, r)
+}
+
+func (m *mockReporter) codes() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var codes []string
+	for _, r := range m.reports {
+		codes = append(codes, r.Code)
+	}
+	return codes
+}
+
+// withReporters replaces the registered reporters for the duration of the test
+func withReporters(t *testing.T) {
+	reportersMu.Lock()
+	saved, savedSample := reporters, sample
+	reporters = nil
+	reportersMu.Unlock()
+
+	t.Cleanup(func() {
+		reportersMu.Lock()
+		reporters, sample = saved, savedSample
+		reportersMu.Unlock()
+	})
+}
+
+func TestReportError_reporters(t *testing.T) {
+	withReporters(t)
+	serverErrors, all, sampled := &mockReporter{}, &mockReporter{}, &mockReporter{}
+	RegisterReporter(serverErrors, ReporterOptions{})
+	RegisterReporter(all, ReporterOptions{MinStatus: 400})
+	RegisterReporter(sampled, ReporterOptions{SampleRate: 0.5})
+
+	samples := []float64{0.7, 0.2}
+	sample = func() float64 {
+		s := samples[0]
+		samples = samples[1:]
+		return s
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/characters/1", nil)
+	ReportError(&Error{Status: http.StatusNotFound, Code: "no_such_character", Desc: "no such character"}, req)
+	ReportError(NewError(errors.New("db down"), "character error"), req)
+	ReportError(errors.New("plain"), req)
+
+	testutil.Equals(t, []string{"internal_error", "internal_error"}, serverErrors.codes())
+	testutil.Equals(t, []string{"no_such_character", "internal_error", "internal_error"}, all.codes())
+	testutil.Equals(t, 1, len(sampled.codes()))
+}
+
+func TestNewReport(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/characters/1", nil)
+	req.RemoteAddr = "10.0.0.7:52311"
+	req.Header.Set("User-Agent", "curl/7.68.0")
+	req = req.WithContext(context.WithValue(req.Context(), requestIDContextKey{}, "c0ffee"))
+
+	rep := newReport(NewError(errors.New("db down"), "character error"), req)
+	testutil.Equals(t, http.StatusInternalServerError, rep.Status)
+	testutil.Equals(t, "internal_error", rep.Code)
+	testutil.Equals(t, "character error: db down", rep.Message)
+	testutil.Equals(t, "c0ffee", rep.RequestID)
+	testutil.Equals(t, "GET", rep.Method)
+	testutil.Equals(t, "/characters/1", rep.Path)
+	testutil.Equals(t, "10.0.0.7", rep.ClientIP)
+	testutil.Equals(t, "curl/7.68.0", rep.UserAgent)
+	testutil.Asserts(t, strings.Contains(rep.Stack, "TestNewReport"), "stack should lead to NewError")
+
+	rep = newReport(PanicError{Value: "boom", Stack: []byte("goroutine 1")}, req)
+	testutil.Equals(t, "goroutine 1", rep.Stack)
+
+	rep = newReport(errors.New("plain"), req)
+	testutil.Equals(t, "", rep.Stack)
+}
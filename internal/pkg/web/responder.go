@@ -13,6 +13,12 @@ const GenericErrorMessage = "Sorry, there was a problem. Please try again later.
 
 // RespondJSON writes JSON as http response
 func RespondJSON(ctx context.Context, w http.ResponseWriter, object interface{}, headers map[string]string) {
+	RespondJSONWithStatus(ctx, w, http.StatusOK, object, headers)
+}
+
+// RespondJSONWithStatus writes JSON as http response with the given status, the status of
+// an *Error object taking precedence
+func RespondJSONWithStatus(ctx context.Context, w http.ResponseWriter, status int, object interface{}, headers map[string]string) {
 	logger := loglib.GetLogger(ctx)
 
 	// Handle json marshalling error
@@ -32,7 +38,6 @@ func RespondJSON(ctx context.Context, w http.ResponseWriter, object interface{},
 	}
 
 	// Handle web error
-	status := http.StatusOK
 	switch werr := object.(type) {
 	case *Error:
 		// Log raw error response
@@ -44,14 +49,18 @@ func RespondJSON(ctx context.Context, w http.ResponseWriter, object interface{},
 			respBytes, _ = json.Marshal(werr)
 		}
 
+		for key, value := range werr.Headers {
+			w.Header().Set(key, value)
+		}
+
 		// Add logger fields
 		logger = logger.WithField("error", "true")
 		status = werr.Status
 	}
 
-	// Log response body
+	// Log response size, not the body, which may carry secrets such as API keys
 	logger.WithField("status", status).
-		InfoF("[Web responder] Wrote %d bytes: %v", len(respBytes), string(respBytes))
+		InfoF("[Web responder] Wrote %d bytes", len(respBytes))
 
 	// Write response
 	w.WriteHeader(status)
@@ -0,0 +1,205 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+)
+
+// StreamFormat is how the rows of a Stream are encoded
+type StreamFormat string
+
+const (
+	// NDJSON writes each row as JSON on its own line
+	NDJSON StreamFormat = "ndjson"
+	// CSV writes a header then each row as a CSV record
+	CSV StreamFormat = "csv"
+)
+
+// streamBufferSize is how much of a Stream is held before being written to the client
+const streamBufferSize = 32 * 1024
+
+// streamMediaTypes maps the media types of Accept to the formats
+var streamMediaTypes = map[string]StreamFormat{
+	"application/x-ndjson": NDJSON,
+	"application/ndjson":   NDJSON,
+	"text/csv":             CSV,
+}
+
+// ContentType is the Content-Type of the format
+func (f StreamFormat) ContentType() string {
+	if f == CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// NegotiateStreamFormat picks the format of ?format=, else the one ranked highest by Accept, NDJSON if either
+// would do. An unknown format is a 400 Error, and an Accept allowing neither a 406 Error
+func NegotiateStreamFormat(r *http.Request) (StreamFormat, error) {
+	if v := r.URL.Query().Get("format"); v != "" {
+		switch f := StreamFormat(strings.ToLower(v)); f {
+		case NDJSON, CSV:
+			return f, nil
+		}
+		return "", NewValidationError(FieldError{Name: "format", Reason: "must be one of ndjson, csv"})
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return NDJSON, nil
+	}
+	var best StreamFormat
+	bestQ := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		f, ok := streamMediaTypes[mediaType]
+		switch {
+		case ok:
+		case mediaType == "*/*", mediaType == "application/*":
+			f = NDJSON
+		case mediaType == "text/*":
+			f = CSV
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	if best == "" {
+		return "", &Error{
+			Status: http.StatusNotAcceptable,
+			Code:   "not_acceptable",
+			Desc:   "only application/x-ndjson and text/csv can be served",
+		}
+	}
+	return best, nil
+}
+
+// Row is a row of a Stream, written as JSON in NDJSON and as its CSVRecord in CSV
+type Row interface {
+	CSVRecord() []string
+}
+
+// Stream writes the rows of a response one at a time, so that unlike RespondJSON the body is never
+// held in memory. The response is compressed with the best coding accepted by the client, as Compress
+// would hold the body back. The status and headers are sent with the first row, so an error may still
+// be responded before it, while after it the response can only be aborted
+type Stream struct {
+	ctx     context.Context
+	w       http.ResponseWriter
+	format  StreamFormat
+	header  []string
+	coding  string
+	encode  Encoder
+	started bool
+	rows    int
+
+	encoder io.WriteCloser
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	json    *json.Encoder
+}
+
+// NewStream returns a Stream of the rows in the format, csvHeader being the first record of CSV
+func NewStream(w http.ResponseWriter, r *http.Request, format StreamFormat, csvHeader []string) *Stream {
+	coding, encode := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	return &Stream{ctx: r.Context(), w: w, format: format, header: csvHeader, coding: coding, encode: encode}
+}
+
+// Started tells whether the status and headers have been sent
+func (s *Stream) Started() bool {
+	return s.started
+}
+
+// start sends the status and headers, and sets up the writers of the body
+func (s *Stream) start() error {
+	s.started = true
+
+	h := s.w.Header()
+	h.Set("Content-Type", s.format.ContentType())
+	h.Add("Vary", "Accept")
+	h.Add("Vary", "Accept-Encoding")
+
+	var body io.Writer = s.w
+	if s.encode != nil {
+		encoder, err := s.encode(s.w)
+		if err != nil {
+			return err
+		}
+		h.Set("Content-Encoding", s.coding)
+		s.encoder, body = encoder, encoder
+	}
+	s.w.WriteHeader(http.StatusOK)
+
+	s.buf = bufio.NewWriterSize(body, streamBufferSize)
+	if s.format == CSV {
+		s.csv = csv.NewWriter(s.buf)
+		if s.header != nil {
+			return s.csv.Write(s.header)
+		}
+		return nil
+	}
+	s.json = json.NewEncoder(s.buf)
+	return nil
+}
+
+// Write writes the row, sending the status and headers first should it be the first one
+func (s *Stream) Write(row Row) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	s.rows++
+	if s.format == CSV {
+		return s.csv.Write(row.CSVRecord())
+	}
+	return s.json.Encode(row)
+}
+
+// Close writes what is left of the response, which is empty but for the CSV header should there be no row
+func (s *Stream) Close() error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if s.encoder != nil {
+		if err := s.encoder.Close(); err != nil {
+			return err
+		}
+	}
+
+	loglib.GetLogger(s.ctx).WithField("status", http.StatusOK).
+		InfoF("[Web stream] Wrote %d rows as %s", s.rows, s.format)
+	return nil
+}
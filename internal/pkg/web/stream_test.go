@@ -0,0 +1,129 @@
+package web
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestNegotiateStreamFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		accept  string
+		want    StreamFormat
+		wantErr string
+	}{
+		{name: "default", want: NDJSON},
+		{name: "format", query: "?format=CSV", accept: "application/x-ndjson", want: CSV},
+		{name: "unknown format", query: "?format=xml", wantErr: "invalid parameters, format: must be one of ndjson, csv"},
+		{name: "ndjson", accept: "application/x-ndjson", want: NDJSON},
+		{name: "csv", accept: "text/csv", want: CSV},
+		{name: "ranked", accept: "application/x-ndjson;q=0.5, text/csv", want: CSV},
+		{name: "any", accept: "*/*", want: NDJSON},
+		{name: "any text", accept: "application/json, text/*;q=0.1", want: CSV},
+		{name: "not acceptable", accept: "application/json", wantErr: "only application/x-ndjson and text/csv can be served"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/export"+tt.query, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			got, err := NegotiateStreamFormat(r)
+			testutil.CompareError(t, tt.wantErr, err)
+			testutil.Equals(t, tt.want, got)
+		})
+	}
+}
+
+type testRow struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (r testRow) CSVRecord() []string {
+	return []string{strconv.Itoa(r.ID), r.Name}
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    StreamFormat
+		acceptEnc string
+		rows      []testRow
+		wantType  string
+		wantBody  string
+	}{
+		{
+			name:     "ndjson",
+			format:   NDJSON,
+			rows:     []testRow{{ID: 1, Name: "Daredevil"}, {ID: 2, Name: `Stick, "the" teacher`}},
+			wantType: "application/x-ndjson",
+			wantBody: `{"id":1,"name":"Daredevil"}` + "\n" + `{"id":2,"name":"Stick, \"the\" teacher"}` + "\n",
+		},
+		{
+			name:     "csv",
+			format:   CSV,
+			rows:     []testRow{{ID: 1, Name: "Daredevil"}, {ID: 2, Name: `Stick, "the" teacher`}},
+			wantType: "text/csv; charset=utf-8",
+			wantBody: "id,name\n1,Daredevil\n2,\"Stick, \"\"the\"\" teacher\"\n",
+		},
+		{
+			name:     "empty csv has the header",
+			format:   CSV,
+			wantType: "text/csv; charset=utf-8",
+			wantBody: "id,name\n",
+		},
+		{
+			name:     "empty ndjson",
+			format:   NDJSON,
+			wantType: "application/x-ndjson",
+			wantBody: "",
+		},
+		{
+			name:      "gzip",
+			format:    NDJSON,
+			acceptEnc: "gzip",
+			rows:      []testRow{{ID: 1, Name: "Daredevil"}},
+			wantType:  "application/x-ndjson",
+			wantBody:  `{"id":1,"name":"Daredevil"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/export", nil)
+			if tt.acceptEnc != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEnc)
+			}
+			w := httptest.NewRecorder()
+
+			s := NewStream(w, r, tt.format, []string{"id", "name"})
+			testutil.Asserts(t, !s.Started(), "nothing should be sent before the first row")
+			for _, row := range tt.rows {
+				testutil.Ok(t, s.Write(row))
+			}
+			testutil.Ok(t, s.Close())
+			testutil.Asserts(t, s.Started(), "the response should be sent once closed")
+
+			testutil.Equals(t, http.StatusOK, w.Code)
+			testutil.Equals(t, tt.wantType, w.Header().Get("Content-Type"))
+			testutil.Equals(t, []string{"Accept", "Accept-Encoding"}, w.Header()["Vary"])
+			body := w.Body.String()
+			if tt.acceptEnc != "" {
+				testutil.Equals(t, tt.acceptEnc, w.Header().Get("Content-Encoding"))
+				zr, err := gzip.NewReader(w.Body)
+				testutil.Ok(t, err)
+				b, err := ioutil.ReadAll(zr)
+				testutil.Ok(t, err)
+				body = string(b)
+			}
+			testutil.Equals(t, tt.wantBody, body)
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package apiclients
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/marvel-forwarder/internal/models/apiclients"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+)
+
+const (
+	// ScopeCharactersRead allows reading the characters
+	ScopeCharactersRead = "characters:read"
+
+	// DefaultRateLimit is the rate limit, in requests per second, of new clients
+	DefaultRateLimit = 10.0
+	// DefaultBurst is the burst of new clients
+	DefaultBurst = 20
+)
+
+// KnownScopes are the scopes which can be given to clients
+var KnownScopes = []string{ScopeCharactersRead}
+
+// ClientSpec is what the admins set on a client, nil fields are left as they are
+type ClientSpec struct {
+	Name      *string
+	RateLimit *float64
+	Burst     *int
+	Scopes    []string
+}
+
+// Admin manages the API clients
+type Admin struct {
+	DB sqlx.ExtContext
+	// Changed, if set, is called once clients have been changed, e.g. to make an
+	// Authenticator forget the keys it knows
+	Changed func()
+}
+
+// Create creates a client, returning it with its key which is not kept anywhere
+func (a *Admin) Create(ctx context.Context, spec ClientSpec) (apiclients.Client, string, error) {
+	c := apiclients.Client{
+		RateLimit: DefaultRateLimit,
+		Burst:     DefaultBurst,
+		Scopes:    []string{ScopeCharactersRead},
+	}
+	if spec.Name == nil {
+		return apiclients.Client{}, "", invalidClient("name is required")
+	}
+	if err := apply(&c, spec); err != nil {
+		return apiclients.Client{}, "", err
+	}
+
+	key, prefix, err := apiclients.GenerateKey()
+	if err != nil {
+		return apiclients.Client{}, "", err
+	}
+	c.KeyPrefix, c.KeyHash = prefix, apiclients.HashKey(key)
+
+	if err = apiclients.Insert(ctx, a.DB, &c); err != nil {
+		return apiclients.Client{}, "", err
+	}
+	return c, key, nil
+}
+
+// List returns all the clients
+func (a *Admin) List(ctx context.Context) ([]apiclients.Client, error) {
+	return apiclients.List(ctx, a.DB)
+}
+
+// Get returns the client with the given ID
+func (a *Admin) Get(ctx context.Context, id int) (apiclients.Client, error) {
+	c, err := apiclients.Get(ctx, a.DB, id)
+	return c, notFound(err)
+}
+
+// Update sets the name, rate limit, burst and scopes of the client, only the fields of the spec being written
+func (a *Admin) Update(ctx context.Context, id int, spec ClientSpec) (apiclients.Client, error) {
+	var c apiclients.Client
+	if err := apply(&c, spec); err != nil {
+		return apiclients.Client{}, err
+	}
+	var name *string
+	if spec.Name != nil {
+		name = &c.Name
+	}
+	if err := notFound(apiclients.Update(ctx, a.DB, id, name, spec.RateLimit, spec.Burst, spec.Scopes)); err != nil {
+		return apiclients.Client{}, err
+	}
+	a.changed()
+	return a.Get(ctx, id)
+}
+
+// Rotate replaces the key of the client, returning the new key which is not kept anywhere
+func (a *Admin) Rotate(ctx context.Context, id int) (apiclients.Client, string, error) {
+	key, prefix, err := apiclients.GenerateKey()
+	if err != nil {
+		return apiclients.Client{}, "", err
+	}
+	if err = notFound(apiclients.UpdateKey(ctx, a.DB, id, prefix, apiclients.HashKey(key))); err != nil {
+		return apiclients.Client{}, "", err
+	}
+	a.changed()
+
+	c, err := a.Get(ctx, id)
+	return c, key, err
+}
+
+// SetSuspended suspends or resumes the client
+func (a *Admin) SetSuspended(ctx context.Context, id int, suspended bool) (apiclients.Client, error) {
+	if err := notFound(apiclients.SetSuspended(ctx, a.DB, id, suspended)); err != nil {
+		return apiclients.Client{}, err
+	}
+	a.changed()
+	return a.Get(ctx, id)
+}
+
+// Delete deletes the client
+func (a *Admin) Delete(ctx context.Context, id int) error {
+	if err := notFound(apiclients.Delete(ctx, a.DB, id)); err != nil {
+		return err
+	}
+	a.changed()
+	return nil
+}
+
+func (a *Admin) changed() {
+	if a.Changed != nil {
+		a.Changed()
+	}
+}
+
+// apply validates the spec and sets it on the client
+func apply(c *apiclients.Client, spec ClientSpec) error {
+	if spec.Name != nil {
+		name := strings.TrimSpace(*spec.Name)
+		if name == "" {
+			return invalidClient("name must not be blank")
+		}
+		c.Name = name
+	}
+	if spec.RateLimit != nil {
+		if *spec.RateLimit <= 0 {
+			return invalidClient("rate_limit must be positive")
+		}
+		c.RateLimit = *spec.RateLimit
+	}
+	if spec.Burst != nil {
+		if *spec.Burst < 1 {
+			return invalidClient("burst must be at least 1")
+		}
+		c.Burst = *spec.Burst
+	}
+	if spec.Scopes != nil {
+		for _, s := range spec.Scopes {
+			if !isKnownScope(s) {
+				return invalidClient(fmt.Sprintf("unknown scope %q, known scopes are %s", s, strings.Join(KnownScopes, ", ")))
+			}
+		}
+		c.Scopes = spec.Scopes
+	}
+	return nil
+}
+
+func isKnownScope(scope string) bool {
+	for _, s := range KnownScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func invalidClient(desc string) error {
+	return &web.Error{
+		Status: http.StatusBadRequest,
+		Code:   "invalid_client",
+		Desc:   desc,
+	}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return &web.Error{
+			Status: http.StatusNotFound,
+			Code:   "no_such_client",
+			Desc:   "no such client",
+		}
+	}
+	return err
+}
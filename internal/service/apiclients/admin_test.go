@@ -0,0 +1,60 @@
+package apiclients
+
+import (
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/apiclients"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestApply(t *testing.T) {
+	rate, zero, burst, negative := 2.5, 0.0, 4, -1
+	name, blank := " reporting ", "  "
+	tests := []struct {
+		name    string
+		spec    ClientSpec
+		want    apiclients.Client
+		wantErr string
+	}{
+		{
+			name: "nothing to change",
+			spec: ClientSpec{},
+			want: apiclients.Client{RateLimit: 1, Burst: 1, Scopes: []string{ScopeCharactersRead}},
+		},
+		{
+			name: "everything changed",
+			spec: ClientSpec{Name: &name, RateLimit: &rate, Burst: &burst, Scopes: []string{}},
+			want: apiclients.Client{Name: "reporting", RateLimit: 2.5, Burst: 4, Scopes: []string{}},
+		},
+		{
+			name:    "blank name",
+			spec:    ClientSpec{Name: &blank},
+			wantErr: "name must not be blank",
+		},
+		{
+			name:    "rate limit not positive",
+			spec:    ClientSpec{RateLimit: &zero},
+			wantErr: "rate_limit must be positive",
+		},
+		{
+			name:    "burst too small",
+			spec:    ClientSpec{Burst: &negative},
+			wantErr: "burst must be at least 1",
+		},
+		{
+			name:    "unknown scope",
+			spec:    ClientSpec{Scopes: []string{"characters:write"}},
+			wantErr: `unknown scope "characters:write"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := apiclients.Client{RateLimit: 1, Burst: 1, Scopes: []string{ScopeCharactersRead}}
+			err := apply(&c, tt.spec)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want, c)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package apiclients
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/marvel-forwarder/internal/models/apiclients"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/ratelimit"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+)
+
+const (
+	// knownKeyTTL is how long a looked up key is trusted before being looked up again
+	knownKeyTTL = 30 * time.Second
+	// maxKnownKeys bounds the number of keys remembered, including the invalid ones
+	maxKnownKeys = 10000
+	// finalFlushTimeout bounds the flush done on shutdown
+	finalFlushTimeout = 10 * time.Second
+)
+
+type knownKey struct {
+	client  apiclients.Client
+	valid   bool
+	expires time.Time
+}
+
+type usage struct {
+	count    int64
+	lastUsed time.Time
+}
+
+// Authenticator identifies clients by their API key and enforces their rate limits
+type Authenticator struct {
+	lookup   func(ctx context.Context, hash string) (apiclients.Client, error)
+	addUsage func(ctx context.Context, id int, count int64, lastUsed time.Time) error
+	limiter  *ratelimit.Limiter
+	now      func() time.Time
+
+	mu    sync.Mutex
+	known map[string]knownKey
+	usage map[int]*usage
+}
+
+// NewAuthenticator returns an Authenticator looking up the clients in db
+func NewAuthenticator(db sqlx.ExtContext) *Authenticator {
+	return &Authenticator{
+		lookup: func(ctx context.Context, hash string) (apiclients.Client, error) {
+			return apiclients.GetByKeyHash(ctx, db, hash)
+		},
+		addUsage: func(ctx context.Context, id int, count int64, lastUsed time.Time) error {
+			return apiclients.AddUsage(ctx, db, id, count, lastUsed)
+		},
+		limiter: ratelimit.NewLimiter(),
+		now:     time.Now,
+		known:   make(map[string]knownKey),
+		usage:   make(map[int]*usage),
+	}
+}
+
+// Authenticate returns the client owning the API key, or a 401 Error if there is none
+func (a *Authenticator) Authenticate(ctx context.Context, key string) (apiclients.Client, error) {
+	hash := apiclients.HashKey(key)
+	now := a.now()
+
+	a.mu.Lock()
+	k, ok := a.known[hash]
+	a.mu.Unlock()
+
+	if !ok || now.After(k.expires) {
+		c, err := a.lookup(ctx, hash)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			k = knownKey{valid: false, expires: now.Add(knownKeyTTL)}
+		case err != nil:
+			return apiclients.Client{}, err
+		default:
+			k = knownKey{client: c, valid: true, expires: now.Add(knownKeyTTL)}
+		}
+
+		a.mu.Lock()
+		if len(a.known) >= maxKnownKeys {
+			a.known = make(map[string]knownKey)
+		}
+		a.known[hash] = k
+		a.mu.Unlock()
+	}
+
+	if !k.valid {
+		return apiclients.Client{}, &web.Error{
+			Status: http.StatusUnauthorized,
+			Code:   "invalid_api_key",
+			Desc:   "invalid API key",
+		}
+	}
+	if k.client.SuspendedAt != nil {
+		return apiclients.Client{}, &web.Error{
+			Status: http.StatusForbidden,
+			Code:   "suspended_api_key",
+			Desc:   "suspended API key",
+		}
+	}
+	return k.client, nil
+}
+
+// Forget makes the keys looked up so far be looked up again, so that changes to the clients
+// apply right away instead of after up to 30 seconds
+func (a *Authenticator) Forget() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.known = make(map[string]knownKey)
+}
+
+// Allow counts a request of the client against its rate limit, returning a 429 Error
+// with Retry-After if it is over the limit
+func (a *Authenticator) Allow(c apiclients.Client) error {
+	now := a.now()
+	ok, wait := a.limiter.Allow(strconv.Itoa(c.ID), c.RateLimit, c.Burst, now)
+	if !ok {
+		err := &web.Error{
+			Status: http.StatusTooManyRequests,
+			Code:   "rate_limited",
+			Desc:   "too many requests",
+		}
+		if wait >= 0 {
+			err.Headers = map[string]string{"Retry-After": strconv.Itoa(int((wait + time.Second - 1) / time.Second))}
+		}
+		return err
+	}
+
+	a.mu.Lock()
+	u, found := a.usage[c.ID]
+	if !found {
+		u = &usage{}
+		a.usage[c.ID] = u
+	}
+	u.count++
+	u.lastUsed = now
+	a.mu.Unlock()
+	return nil
+}
+
+// FlushUsage adds the requests counted since the last flush to the usage of the clients in the DB
+func (a *Authenticator) FlushUsage(ctx context.Context) error {
+	a.mu.Lock()
+	pending := a.usage
+	a.usage = make(map[int]*usage)
+	a.mu.Unlock()
+
+	for id, u := range pending {
+		if err := a.addUsage(ctx, id, u.count, u.lastUsed); err != nil {
+			// put back what could not be flushed, so that it is retried next time
+			a.mu.Lock()
+			for id, u := range pending {
+				if cur, ok := a.usage[id]; ok {
+					cur.count += u.count
+				} else {
+					a.usage[id] = u
+				}
+			}
+			a.mu.Unlock()
+			return err
+		}
+		delete(pending, id)
+	}
+	return nil
+}
+
+// RunUsageFlusher flushes the usage every interval until ctx is done, and once more then
+func (a *Authenticator) RunUsageFlusher(ctx context.Context, interval time.Duration) {
+	lg := loglib.GetLogger(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+			if err := a.FlushUsage(flushCtx); err != nil {
+				lg.ErrorF("[API clients] flushing usage: %s", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := a.FlushUsage(ctx); err != nil {
+				lg.ErrorF("[API clients] flushing usage: %s", err)
+			}
+		}
+	}
+}
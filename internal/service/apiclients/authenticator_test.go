@@ -0,0 +1,159 @@
+package apiclients
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/apiclients"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func newTestAuthenticator(clients map[string]apiclients.Client, lookups *int) *Authenticator {
+	a := NewAuthenticator(nil)
+	a.lookup = func(ctx context.Context, hash string) (apiclients.Client, error) {
+		*lookups++
+		for key, c := range clients {
+			if apiclients.HashKey(key) == hash {
+				return c, nil
+			}
+		}
+		if hash == apiclients.HashKey("mf_wonky") {
+			return apiclients.Client{}, fmt.Errorf("db down")
+		}
+		return apiclients.Client{}, sql.ErrNoRows
+	}
+	return a
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	analytics := apiclients.Client{ID: 1, Name: "analytics", RateLimit: 1, Burst: 1}
+	tests := []struct {
+		name        string
+		keys        []string
+		want        apiclients.Client
+		wantErr     string
+		wantLookups int
+	}{
+		{
+			name:        "valid key looked up once",
+			keys:        []string{"mf_good", "mf_good", "mf_good"},
+			want:        analytics,
+			wantLookups: 1,
+		},
+		{
+			name:        "invalid key looked up once",
+			keys:        []string{"mf_bad", "mf_bad"},
+			wantErr:     "invalid API key",
+			wantLookups: 1,
+		},
+		{
+			name:        "suspended key",
+			keys:        []string{"mf_suspended"},
+			wantErr:     "suspended API key",
+			wantLookups: 1,
+		},
+		{
+			name:        "lookup errors are not remembered",
+			keys:        []string{"mf_wonky", "mf_wonky"},
+			wantErr:     "db down",
+			wantLookups: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lookups int
+			suspended := time.Now()
+			a := newTestAuthenticator(map[string]apiclients.Client{
+				"mf_good":      analytics,
+				"mf_suspended": {ID: 2, SuspendedAt: &suspended},
+			}, &lookups)
+			for _, key := range tt.keys {
+				got, err := a.Authenticate(context.TODO(), key)
+				testutil.CompareError(t, tt.wantErr, err)
+				if err == nil {
+					testutil.Equals(t, tt.want, got)
+				}
+			}
+			testutil.Equals(t, tt.wantLookups, lookups)
+		})
+	}
+}
+
+func TestAuthenticator_Authenticate_expiry(t *testing.T) {
+	var lookups int
+	now := time.Now()
+	a := newTestAuthenticator(map[string]apiclients.Client{"mf_good": {ID: 1}}, &lookups)
+	a.now = func() time.Time { return now }
+
+	_, err := a.Authenticate(context.TODO(), "mf_good")
+	testutil.Ok(t, err)
+	now = now.Add(knownKeyTTL + time.Second)
+	_, err = a.Authenticate(context.TODO(), "mf_good")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, lookups)
+}
+
+func TestAuthenticator_Forget(t *testing.T) {
+	var lookups int
+	a := newTestAuthenticator(map[string]apiclients.Client{"mf_good": {ID: 1}}, &lookups)
+
+	_, err := a.Authenticate(context.TODO(), "mf_good")
+	testutil.Ok(t, err)
+	a.Forget()
+	_, err = a.Authenticate(context.TODO(), "mf_good")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, lookups)
+}
+
+func TestAuthenticator_Allow(t *testing.T) {
+	now := time.Now()
+	a := NewAuthenticator(nil)
+	a.now = func() time.Time { return now }
+	c := apiclients.Client{ID: 1, RateLimit: 0.5, Burst: 2}
+
+	testutil.Ok(t, a.Allow(c))
+	testutil.Ok(t, a.Allow(c))
+	err := a.Allow(c)
+	webErr := web.TypecastError(err)
+	testutil.Asserts(t, webErr != nil, "should be a web error")
+	testutil.Equals(t, http.StatusTooManyRequests, webErr.Status)
+	testutil.Equals(t, "2", webErr.Headers["Retry-After"])
+
+	now = now.Add(2 * time.Second)
+	testutil.Ok(t, a.Allow(c))
+	testutil.Ok(t, a.Allow(apiclients.Client{ID: 2, RateLimit: 0.5, Burst: 2}))
+}
+
+func TestAuthenticator_FlushUsage(t *testing.T) {
+	a := NewAuthenticator(nil)
+	flushed := make(map[int]int64)
+	var failing bool
+	a.addUsage = func(ctx context.Context, id int, count int64, lastUsed time.Time) error {
+		if failing {
+			return fmt.Errorf("db down")
+		}
+		flushed[id] += count
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+		testutil.Ok(t, a.Allow(apiclients.Client{ID: 1, RateLimit: 1, Burst: 10}))
+	}
+	testutil.Ok(t, a.Allow(apiclients.Client{ID: 2, RateLimit: 1, Burst: 10}))
+
+	failing = true
+	testutil.CompareError(t, "db down", a.FlushUsage(context.TODO()))
+	testutil.Ok(t, a.Allow(apiclients.Client{ID: 1, RateLimit: 1, Burst: 10}))
+
+	failing = false
+	testutil.Ok(t, a.FlushUsage(context.TODO()))
+	testutil.Equals(t, map[int]int64{1: 4, 2: 1}, flushed)
+
+	testutil.Ok(t, a.FlushUsage(context.TODO()))
+	testutil.Equals(t, map[int]int64{1: 4, 2: 1}, flushed)
+}
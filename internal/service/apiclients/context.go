@@ -0,0 +1,22 @@
+package apiclients
+
+import (
+	"context"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/apiclients"
+)
+
+type contextKey string
+
+var clientContextKey = contextKey("api_client")
+
+// WithClient returns a copy of ctx carrying the authenticated client
+func WithClient(ctx context.Context, c apiclients.Client) context.Context {
+	return context.WithValue(ctx, clientContextKey, c)
+}
+
+// ClientFromContext returns the authenticated client carried by ctx, if any
+func ClientFromContext(ctx context.Context) (apiclients.Client, bool) {
+	c, ok := ctx.Value(clientContextKey).(apiclients.Client)
+	return c, ok
+}
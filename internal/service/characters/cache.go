@@ -0,0 +1,294 @@
+package characters
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/characters"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/database"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/metrics"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/singleflight"
+)
+
+const (
+	idsKey    = "ids"
+	syncedKey = "synced"
+	listKey   = "list"
+
+	// loadTimeout bounds a load from the underlying store, which no request bounds as
+	// it is shared by all those missing the same key
+	loadTimeout = 30 * time.Second
+)
+
+// cacheLookups counts the lookups of CachedStore, the hit rate being hits over all lookups
+var cacheLookups = metrics.NewCounter("characters_cache_lookups_total",
+	"Lookups in the in-memory cache of the characters, per kind and result (hit or miss).", "kind", "result")
+
+// CachedStore keeps what the underlying store returns in memory for a while.
+// Concurrent misses of the same key share a single call to the underlying store
+type CachedStore struct {
+	store      Reader
+	ttl        time.Duration
+	maxEntries int
+	group      singleflight.Group
+
+	mu         sync.Mutex
+	generation uint64
+	// primaryUntil is when the replicas have surely replayed the last sync notified, the cache
+	// being filled from the primary until then
+	primaryUntil time.Time
+	ids          []int
+	idsExpires   time.Time
+	synced       *time.Time
+	syncedExp    time.Time
+	// list is all the characters with all their fields, the others being projected from it
+	list        []characters.Character
+	listExpires time.Time
+	lru         *list.List
+	entries     map[int]*list.Element
+}
+
+type cacheEntry struct {
+	id        int
+	character characters.Character
+	expires   time.Time
+}
+
+// NewCachedStore returns a CachedStore keeping results for ttl and at most maxEntries characters
+func NewCachedStore(store Reader, ttl time.Duration, maxEntries int) *CachedStore {
+	return &CachedStore{
+		store:      store,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[int]*list.Element),
+	}
+}
+
+// GetCharacterIDs returns the ID of all characters, from memory if possible.
+// The IDs are a copy the caller may change
+func (c *CachedStore) GetCharacterIDs(ctx context.Context) ([]int, error) {
+	ids, err := c.getIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append([]int(nil), ids...), nil
+}
+
+// getIDs returns the ID of all characters, from memory if possible, which must not be changed
+func (c *CachedStore) getIDs(ctx context.Context) ([]int, error) {
+	c.mu.Lock()
+	if c.ids != nil && time.Now().Before(c.idsExpires) {
+		ids := c.ids
+		c.mu.Unlock()
+		cacheLookups.Inc("ids", "hit")
+		return ids, nil
+	}
+	generation := c.generation
+	ctx = c.fillContext(ctx)
+	c.mu.Unlock()
+	cacheLookups.Inc("ids", "miss")
+
+	v, err, _ := c.group.DoContext(ctx, idsKey, loadTimeout, func(ctx context.Context) (interface{}, error) {
+		ids, err := c.store.GetCharacterIDs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if generation == c.generation {
+			c.ids = ids
+			c.idsExpires = time.Now().Add(c.ttl)
+		}
+		c.mu.Unlock()
+		return ids, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]int), nil
+}
+
+// GetCharacters returns all the characters with only the fields, from memory if possible.
+// Only the full list is kept, so that the catalogue is held once whatever the fields asked for,
+// the fields being projected from it into a copy the caller may change
+func (c *CachedStore) GetCharacters(ctx context.Context, fields ...characters.Field) ([]characters.Character, error) {
+	if err := characters.CheckFields(fields); err != nil {
+		return nil, err
+	}
+	chs, err := c.getList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	projected := make([]characters.Character, len(chs))
+	for i, ch := range chs {
+		projected[i] = ch.Project(fields...)
+	}
+	return projected, nil
+}
+
+// getList returns all the characters with all their fields, from memory if possible, which must not be changed
+func (c *CachedStore) getList(ctx context.Context) ([]characters.Character, error) {
+	c.mu.Lock()
+	if c.list != nil && time.Now().Before(c.listExpires) {
+		chs := c.list
+		c.mu.Unlock()
+		cacheLookups.Inc("list", "hit")
+		return chs, nil
+	}
+	generation := c.generation
+	ctx = c.fillContext(ctx)
+	c.mu.Unlock()
+	cacheLookups.Inc("list", "miss")
+
+	v, err, _ := c.group.DoContext(ctx, listKey, loadTimeout, func(ctx context.Context) (interface{}, error) {
+		chs, err := c.store.GetCharacters(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if generation == c.generation {
+			c.list = chs
+			c.listExpires = time.Now().Add(c.ttl)
+		}
+		c.mu.Unlock()
+		return chs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]characters.Character), nil
+}
+
+// LastSynced returns when the characters were last synced, from memory if possible
+func (c *CachedStore) LastSynced(ctx context.Context) (time.Time, error) {
+	c.mu.Lock()
+	if c.synced != nil && time.Now().Before(c.syncedExp) {
+		synced := *c.synced
+		c.mu.Unlock()
+		cacheLookups.Inc("synced", "hit")
+		return synced, nil
+	}
+	generation := c.generation
+	ctx = c.fillContext(ctx)
+	c.mu.Unlock()
+	cacheLookups.Inc("synced", "miss")
+
+	v, err, _ := c.group.DoContext(ctx, syncedKey, loadTimeout, func(ctx context.Context) (interface{}, error) {
+		synced, err := c.store.LastSynced(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if generation == c.generation {
+			c.synced = &synced
+			c.syncedExp = time.Now().Add(c.ttl)
+		}
+		c.mu.Unlock()
+		return synced, nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return v.(time.Time), nil
+}
+
+// GetCharacter returns the character with the given id, from memory if possible
+func (c *CachedStore) GetCharacter(ctx context.Context, id int) (characters.Character, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[id]; ok {
+		entry := el.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			cacheLookups.Inc("character", "hit")
+			return entry.character, nil
+		}
+		c.lru.Remove(el)
+		delete(c.entries, id)
+	}
+	generation := c.generation
+	ctx = c.fillContext(ctx)
+	c.mu.Unlock()
+	cacheLookups.Inc("character", "miss")
+
+	v, err, _ := c.group.DoContext(ctx, strconv.Itoa(id), loadTimeout, func(ctx context.Context) (interface{}, error) {
+		ch, err := c.store.GetCharacter(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if generation == c.generation {
+			c.add(id, ch)
+		}
+		c.mu.Unlock()
+		return ch, nil
+	})
+	if err != nil {
+		return characters.Character{}, err
+	}
+	return v.(characters.Character), nil
+}
+
+// fillContext returns the context to load what is missing from the cache with, reading from the
+// primary should a sync have been notified too recently for the replicas to have it. c.mu must be held
+func (c *CachedStore) fillContext(ctx context.Context) context.Context {
+	if time.Now().Before(c.primaryUntil) {
+		return database.WithPrimary(ctx)
+	}
+	return ctx
+}
+
+// add caches the character, evicting the least recently used one if full. c.mu must be held
+func (c *CachedStore) add(id int, ch characters.Character) {
+	if c.maxEntries <= 0 {
+		return
+	}
+	entry := &cacheEntry{id: id, character: ch, expires: time.Now().Add(c.ttl)}
+	if el, ok := c.entries[id]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	for c.lru.Len() >= c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).id)
+	}
+	c.entries[id] = c.lru.PushFront(entry)
+}
+
+// Invalidate drops everything in memory, results being loaded when called are not kept
+func (c *CachedStore) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidate()
+}
+
+// invalidateSynced invalidates the cache once a sync is committed, filling it from the primary
+// for replicaLag, how far behind it the replicas may be
+func (c *CachedStore) invalidateSynced(replicaLag time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidate()
+	if replicaLag > 0 {
+		c.primaryUntil = time.Now().Add(replicaLag)
+	}
+}
+
+// invalidate drops everything in memory. c.mu must be held
+func (c *CachedStore) invalidate() {
+	c.generation++
+	c.ids = nil
+	c.synced = nil
+	c.list = nil
+	c.lru.Init()
+	c.entries = make(map[int]*list.Element)
+}
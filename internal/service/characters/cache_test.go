@@ -0,0 +1,291 @@
+package characters
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/characters"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/database"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+	"github.com/lib/pq"
+)
+
+type countingReader struct {
+	idCalls        int32
+	listCalls      int32
+	characterCalls int32
+	err            error
+}
+
+func (r *countingReader) reader() mockReader {
+	return mockReader{
+		getCharacterIDsFn: func(ctx context.Context) ([]int, error) {
+			n := atomic.AddInt32(&r.idCalls, 1)
+			if r.err != nil {
+				return nil, r.err
+			}
+			return []int{int(n)}, nil
+		},
+		getCharactersFn: func(ctx context.Context, fields ...characters.Field) ([]characters.Character, error) {
+			n := atomic.AddInt32(&r.listCalls, 1)
+			if r.err != nil {
+				return nil, r.err
+			}
+			return []characters.Character{{ID: int(n), Name: fmt.Sprint(fields)}}, nil
+		},
+		getCharacterFn: func(ctx context.Context, id int) (characters.Character, error) {
+			n := atomic.AddInt32(&r.characterCalls, 1)
+			if r.err != nil {
+				return characters.Character{}, r.err
+			}
+			return characters.Character{ID: id, Name: fmt.Sprintf("load %d", n)}, nil
+		},
+	}
+}
+
+func TestCachedStore_GetCharacterIDs(t *testing.T) {
+	r := &countingReader{}
+	c := NewCachedStore(r.reader(), time.Minute, 10)
+
+	for i := 0; i < 3; i++ {
+		ids, err := c.GetCharacterIDs(context.TODO())
+		testutil.Ok(t, err)
+		testutil.Equals(t, []int{1}, ids)
+	}
+	testutil.Equals(t, int32(1), r.idCalls)
+
+	c.Invalidate()
+	ids, err := c.GetCharacterIDs(context.TODO())
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int{2}, ids)
+}
+
+func TestCachedStore_GetCharacters(t *testing.T) {
+	r := &countingReader{}
+	c := NewCachedStore(r.reader(), time.Minute, 10)
+
+	// the full list is cached once, the fields being projected from it
+	for i := 0; i < 3; i++ {
+		chs, err := c.GetCharacters(context.TODO(), characters.FieldID)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []characters.Character{{ID: 1}}, chs)
+	}
+	chs, err := c.GetCharacters(context.TODO())
+	testutil.Ok(t, err)
+	testutil.Equals(t, []characters.Character{{ID: 1, Name: "[]"}}, chs)
+	testutil.Equals(t, int32(1), r.listCalls)
+
+	_, err = c.GetCharacters(context.TODO(), "comics")
+	testutil.CompareError(t, `unknown field "comics"`, err)
+	testutil.Equals(t, int32(1), r.listCalls)
+
+	c.Invalidate()
+	chs, err = c.GetCharacters(context.TODO(), characters.FieldID, characters.FieldName)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []characters.Character{{ID: 2, Name: "[]"}}, chs)
+
+	r.err = fmt.Errorf("mock error")
+	c.Invalidate()
+	_, err = c.GetCharacters(context.TODO())
+	testutil.CompareError(t, "mock error", err)
+}
+
+func TestCachedStore_copies(t *testing.T) {
+	r := &countingReader{}
+	c := NewCachedStore(r.reader(), time.Minute, 10)
+
+	ids, err := c.GetCharacterIDs(context.TODO())
+	testutil.Ok(t, err)
+	ids[0] = 42
+	chs, err := c.GetCharacters(context.TODO())
+	testutil.Ok(t, err)
+	chs[0].Name = "changed"
+
+	ids, err = c.GetCharacterIDs(context.TODO())
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int{1}, ids)
+	chs, err = c.GetCharacters(context.TODO())
+	testutil.Ok(t, err)
+	testutil.Equals(t, []characters.Character{{ID: 1, Name: "[]"}}, chs)
+}
+
+func TestCachedStore_callerGone(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	c := NewCachedStore(mockReader{getCharacterFn: func(ctx context.Context, id int) (characters.Character, error) {
+		close(started)
+		<-release
+		return characters.Character{ID: id}, ctx.Err()
+	}}, time.Minute, 10)
+
+	// the request which started the load goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := c.GetCharacter(ctx, 1)
+		firstErr <- err
+	}()
+	<-started
+	other := make(chan error, 1)
+	go func() {
+		_, err := c.GetCharacter(context.Background(), 1)
+		other <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	testutil.CompareError(t, context.Canceled.Error(), <-firstErr)
+
+	close(release)
+	testutil.Ok(t, <-other)
+}
+
+func TestCachedStore_GetCharacter(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		maxEntries int
+		err        error
+		ids        []int
+		wantCalls  int32
+		wantErr    string
+	}{
+		{
+			name:       "repeated hits",
+			ttl:        time.Minute,
+			maxEntries: 10,
+			ids:        []int{1, 1, 2, 1, 2},
+			wantCalls:  2,
+		},
+		{
+			name:       "expired",
+			ttl:        -time.Second,
+			maxEntries: 10,
+			ids:        []int{1, 1, 1},
+			wantCalls:  3,
+		},
+		{
+			name:       "least recently used evicted",
+			ttl:        time.Minute,
+			maxEntries: 2,
+			ids:        []int{1, 2, 1, 3, 1, 2},
+			wantCalls:  4,
+		},
+		{
+			name:       "errors are not cached",
+			ttl:        time.Minute,
+			maxEntries: 10,
+			err:        fmt.Errorf("db down"),
+			ids:        []int{1, 1},
+			wantCalls:  2,
+			wantErr:    "db down",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &countingReader{err: tt.err}
+			c := NewCachedStore(r.reader(), tt.ttl, tt.maxEntries)
+			for _, id := range tt.ids {
+				ch, err := c.GetCharacter(context.TODO(), id)
+				testutil.CompareError(t, tt.wantErr, err)
+				if err == nil {
+					testutil.Equals(t, id, ch.ID)
+				}
+			}
+			testutil.Equals(t, tt.wantCalls, r.characterCalls)
+		})
+	}
+}
+
+func TestCachedStore_Invalidate_duringLoad(t *testing.T) {
+	var c *CachedStore
+	var calls int32
+	c = NewCachedStore(mockReader{getCharacterFn: func(ctx context.Context, id int) (characters.Character, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// a sync lands while the first load is in flight
+			c.Invalidate()
+		}
+		return characters.Character{ID: id}, nil
+	}}, time.Minute, 10)
+
+	_, err := c.GetCharacter(context.TODO(), 1)
+	testutil.Ok(t, err)
+	_, err = c.GetCharacter(context.TODO(), 1)
+	testutil.Ok(t, err)
+	_, err = c.GetCharacter(context.TODO(), 1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int32(2), calls)
+}
+
+func TestCachedStore_invalidateOn(t *testing.T) {
+	r := &countingReader{}
+	c := NewCachedStore(r.reader(), time.Minute, 10)
+	_, err := c.GetCharacter(context.TODO(), 1)
+	testutil.Ok(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	notifications := make(chan *pq.Notification)
+	done := make(chan struct{})
+	go func() {
+		c.invalidateOn(ctx, notifications, func() error { return nil }, 0)
+		close(done)
+	}()
+
+	notifications <- &pq.Notification{Channel: characters.SyncedChannel}
+	// unbuffered, so the first notification has been handled once the second one is taken
+	notifications <- nil
+	cancel()
+	<-done
+
+	_, err = c.GetCharacter(context.TODO(), 1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int32(2), r.characterCalls)
+}
+
+func TestCachedStore_invalidateSynced(t *testing.T) {
+	var primary []bool
+	c := NewCachedStore(mockReader{getCharacterFn: func(ctx context.Context, id int) (characters.Character, error) {
+		primary = append(primary, database.PrimaryFromContext(ctx))
+		return characters.Character{ID: id}, nil
+	}}, time.Minute, 10)
+
+	_, err := c.GetCharacter(context.TODO(), 1)
+	testutil.Ok(t, err)
+
+	// the replicas may not have the sync yet
+	c.invalidateSynced(time.Hour)
+	_, err = c.GetCharacter(context.TODO(), 1)
+	testutil.Ok(t, err)
+
+	// they have it by now
+	c.mu.Lock()
+	c.primaryUntil = time.Now()
+	c.mu.Unlock()
+	c.Invalidate()
+	_, err = c.GetCharacter(context.TODO(), 1)
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, []bool{false, true, false}, primary)
+}
+
+func TestCachedStore_LastSynced(t *testing.T) {
+	var calls int32
+	synced := time.Date(2021, time.March, 3, 10, 0, 0, 0, time.UTC)
+	c := NewCachedStore(mockReader{lastSyncedFn: func(ctx context.Context) (time.Time, error) {
+		atomic.AddInt32(&calls, 1)
+		return synced, nil
+	}}, time.Minute, 10)
+
+	for i := 0; i < 3; i++ {
+		got, err := c.LastSynced(context.TODO())
+		testutil.Ok(t, err)
+		testutil.Equals(t, synced, got)
+	}
+	testutil.Equals(t, int32(1), calls)
+
+	c.Invalidate()
+	_, err := c.LastSynced(context.TODO())
+	testutil.Ok(t, err)
+	testutil.Equals(t, int32(2), calls)
+}
@@ -2,21 +2,30 @@ package characters
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/kagelui/marvel-forwarder/internal/models/characters"
 	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
 )
 
-// ModelStore contains a reference to the DB connection and provides the service to handlers
+// Reader is implemented by the stores serving characters
+type Reader interface {
+	GetCharacterIDs(ctx context.Context) ([]int, error)
+	GetCharacters(ctx context.Context, fields ...characters.Field) ([]characters.Character, error)
+	GetCharacter(ctx context.Context, id int) (characters.Character, error)
+	LastSynced(ctx context.Context) (time.Time, error)
+}
+
+// ModelStore contains a reference to the repository of the characters and provides the service to handlers
 type ModelStore struct {
-	DB characters.Inquirer
+	Repo characters.Repository
 }
 
-// GetCharacterIDs returns the ID of all characters in the DB
+// GetCharacterIDs returns the ID of all characters in the repository
 func (m *ModelStore) GetCharacterIDs(ctx context.Context) ([]int, error) {
-	chs, err := characters.GetCharacters(ctx, m.DB)
+	chs, err := m.Repo.GetCharacters(ctx, characters.FieldID)
 	if err != nil {
 		return nil, err
 	}
@@ -29,11 +38,16 @@ func (m *ModelStore) GetCharacterIDs(ctx context.Context) ([]int, error) {
 	return result, err
 }
 
+// GetCharacters returns all the characters in the repository with only the fields, or with all of them if there is none
+func (m *ModelStore) GetCharacters(ctx context.Context, fields ...characters.Field) ([]characters.Character, error) {
+	return m.Repo.GetCharacters(ctx, fields...)
+}
+
 // GetCharacter returns the character with the given id
 func (m *ModelStore) GetCharacter(ctx context.Context, id int) (characters.Character, error) {
-	ch, err := characters.GetCharacter(ctx, m.DB, id)
+	ch, err := m.Repo.GetCharacter(ctx, id)
 	switch {
-	case err == sql.ErrNoRows:
+	case errors.Is(err, characters.ErrNotFound):
 		return characters.Character{}, &web.Error{
 			Status: http.StatusNotFound,
 			Code:   "no_such_character",
@@ -45,3 +59,20 @@ func (m *ModelStore) GetCharacter(ctx context.Context, id int) (characters.Chara
 
 	return ch, nil
 }
+
+// LastSynced returns when the characters were last synced from Marvel, zero if they never were
+func (m *ModelStore) LastSynced(ctx context.Context) (time.Time, error) {
+	s, err := m.Repo.LatestSync(ctx)
+	switch {
+	case errors.Is(err, characters.ErrNotFound):
+		return time.Time{}, nil
+	case err != nil:
+		return time.Time{}, err
+	}
+	return s.CompletedAt, nil
+}
+
+// EachCharacter calls fn with every character in the repository, ordered by ID, without holding them all in memory
+func (m *ModelStore) EachCharacter(ctx context.Context, fn func(characters.Character) error) error {
+	return m.Repo.EachCharacter(ctx, fn)
+}
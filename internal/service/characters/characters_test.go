@@ -56,19 +56,17 @@ func TestModelStore_GetCharacter(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tx := db.MustBegin()
-			tx.MustExec(`TRUNCATE characters`)
-			testutil.Ok(t, tt.f.characters.SaveWithTx(context.TODO(), tx))
+			repo := characters.NewMemory()
+			testutil.Ok(t, repo.SaveCharacters(context.TODO(), tt.f.characters))
 
 			m := &ModelStore{
-				DB: tx,
+				Repo: repo,
 			}
 			got, err := m.GetCharacter(context.TODO(), tt.id)
 			testutil.CompareError(t, tt.wantErr, err)
 			if err == nil {
 				testutil.Equals(t, tt.want, got)
 			}
-			testutil.Ok(t, tx.Rollback())
 		})
 	}
 }
@@ -84,7 +82,7 @@ func TestModelStore_GetCharacterIDs(t *testing.T) {
 		wantErr string
 	}{
 		{
-			name:    "should return empty slice should DB be empty",
+			name:    "should return empty slice should the repository be empty",
 			f:       fixture{},
 			want:    []int{},
 			wantErr: "",
@@ -114,19 +112,51 @@ func TestModelStore_GetCharacterIDs(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tx := db.MustBegin()
-			tx.MustExec(`TRUNCATE characters`)
-			testutil.Ok(t, tt.f.characters.SaveWithTx(context.TODO(), tx))
+			repo := characters.NewMemory()
+			testutil.Ok(t, repo.SaveCharacters(context.TODO(), tt.f.characters))
 
 			m := &ModelStore{
-				DB: tx,
+				Repo: repo,
 			}
 			got, err := m.GetCharacterIDs(context.TODO())
 			testutil.CompareError(t, tt.wantErr, err)
 			if err == nil {
 				testutil.Equals(t, tt.want, got)
 			}
-			testutil.Ok(t, tx.Rollback())
+		})
+	}
+}
+
+func TestModelStore_LastSynced(t *testing.T) {
+	tests := []struct {
+		name     string
+		syncs    int
+		wantZero bool
+	}{
+		{
+			name:     "never synced",
+			syncs:    0,
+			wantZero: true,
+		},
+		{
+			name:     "synced",
+			syncs:    2,
+			wantZero: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := characters.NewMemory()
+			for i := 0; i < tt.syncs; i++ {
+				testutil.Ok(t, repo.SaveSync(context.TODO(), nil))
+			}
+
+			m := &ModelStore{
+				Repo: repo,
+			}
+			got, err := m.LastSynced(context.TODO())
+			testutil.Ok(t, err)
+			testutil.Equals(t, tt.wantZero, got.IsZero())
 		})
 	}
 }
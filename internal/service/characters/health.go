@@ -0,0 +1,25 @@
+package characters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SyncedWithin returns a health check failing should the characters of store not have been
+// synced successfully for maxAge
+func SyncedWithin(store Reader, maxAge time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		synced, err := store.LastSynced(ctx)
+		switch {
+		case err != nil:
+			return err
+		case synced.IsZero():
+			return errors.New("never synced")
+		case time.Since(synced) > maxAge:
+			return fmt.Errorf("last synced %s ago, more than %s", time.Since(synced).Round(time.Second), maxAge)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,32 @@
+package characters
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestSyncedWithin(t *testing.T) {
+	tests := []struct {
+		name    string
+		synced  time.Time
+		err     error
+		wantErr string
+	}{
+		{name: "fresh", synced: time.Now().Add(-time.Minute)},
+		{name: "stale", synced: time.Now().Add(-2 * time.Hour), wantErr: "last synced 2h0m0s ago, more than 1h0m0s"},
+		{name: "never synced", wantErr: "never synced"},
+		{name: "store error", err: errors.New("db down"), wantErr: "db down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := SyncedWithin(mockReader{lastSyncedFn: func(ctx context.Context) (time.Time, error) {
+				return tt.synced, tt.err
+			}}, time.Hour)
+			testutil.CompareError(t, tt.wantErr, check(context.TODO()))
+		})
+	}
+}
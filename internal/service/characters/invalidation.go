@@ -0,0 +1,70 @@
+package characters
+
+import (
+	"context"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/characters"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	"github.com/lib/pq"
+)
+
+const (
+	listenerMinReconnect = 10 * time.Second
+	listenerMaxReconnect = time.Minute
+	listenerPingInterval = 90 * time.Second
+)
+
+// ListenForSyncs invalidates the cache every time bifrost notifies a sync, until ctx is done.
+// The cache is then filled from the primary for replicaLag, how far behind it the replicas read
+// from may be, so that it does not keep what they had before the sync
+func (c *CachedStore) ListenForSyncs(ctx context.Context, dbAddr string, replicaLag time.Duration) error {
+	lg := loglib.GetLogger(ctx)
+
+	listener := pq.NewListener(dbAddr, listenerMinReconnect, listenerMaxReconnect, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			lg.ErrorF("[Cache] sync listener: %s", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(characters.SyncedChannel); err != nil {
+		return err
+	}
+	lg.InfoF("[Cache] listening for syncs on %s", characters.SyncedChannel)
+
+	c.invalidateOn(ctx, listener.Notify, func() error {
+		return listener.Ping()
+	}, replicaLag)
+	return nil
+}
+
+// invalidateOn invalidates the cache for every notification received until ctx is done.
+// A nil notification means the connection was re-established and notifications may
+// have been missed, so the cache is invalidated as well
+func (c *CachedStore) invalidateOn(ctx context.Context, notifications <-chan *pq.Notification, ping func() error, replicaLag time.Duration) {
+	lg := loglib.GetLogger(ctx)
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-notifications:
+			if !ok {
+				return
+			}
+			if n == nil {
+				lg.InfoF("[Cache] sync listener reconnected, invalidating")
+			} else {
+				lg.InfoF("[Cache] sync notified, invalidating")
+			}
+			c.invalidateSynced(replicaLag)
+		case <-ticker.C:
+			if err := ping(); err != nil {
+				lg.ErrorF("[Cache] sync listener ping: %s", err)
+			}
+		}
+	}
+}
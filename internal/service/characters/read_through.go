@@ -0,0 +1,184 @@
+package characters
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/characters"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/singleflight"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+	"github.com/kagelui/marvel-forwarder/internal/service/marvel"
+)
+
+const (
+	// maxNegativeEntries bounds the number of unknown IDs remembered by ReadThroughStore
+	maxNegativeEntries = 10000
+	// fetchTimeout bounds a fetch from Marvel and the save of the character, which no request
+	// bounds as it is shared by all those asking for the character
+	fetchTimeout = 30 * time.Second
+)
+
+type characterFetcher interface {
+	RetrieveCharacter(ctx context.Context, id int) (characters.Character, error)
+}
+
+// ReadThroughStore serves characters from the underlying store, fetching a missing
+// character from Marvel and saving it before returning it
+type ReadThroughStore struct {
+	store   Reader
+	fetcher characterFetcher
+	save    func(ctx context.Context, chs characters.CharacterSlice) error
+
+	negative *negativeCache
+	group    singleflight.Group
+}
+
+// NewReadThroughStore returns a ReadThroughStore saving fetched characters to repo.
+// IDs unknown to Marvel are not asked for again until negativeTTL has passed
+func NewReadThroughStore(store Reader, repo characters.Repository, fetcher characterFetcher, negativeTTL time.Duration) *ReadThroughStore {
+	return &ReadThroughStore{
+		store:   store,
+		fetcher: fetcher,
+		save: func(ctx context.Context, chs characters.CharacterSlice) error {
+			return repo.SaveCharacters(ctx, chs)
+		},
+		negative: newNegativeCache(negativeTTL, maxNegativeEntries),
+	}
+}
+
+// GetCharacterIDs returns the ID of all characters in the underlying store
+func (s *ReadThroughStore) GetCharacterIDs(ctx context.Context) ([]int, error) {
+	return s.store.GetCharacterIDs(ctx)
+}
+
+// GetCharacters returns all the characters in the underlying store with only the fields
+func (s *ReadThroughStore) GetCharacters(ctx context.Context, fields ...characters.Field) ([]characters.Character, error) {
+	return s.store.GetCharacters(ctx, fields...)
+}
+
+// LastSynced returns when the underlying store was last synced
+func (s *ReadThroughStore) LastSynced(ctx context.Context) (time.Time, error) {
+	return s.store.LastSynced(ctx)
+}
+
+// GetCharacter returns the character with the given id, asking Marvel for it should it be missing
+func (s *ReadThroughStore) GetCharacter(ctx context.Context, id int) (characters.Character, error) {
+	ch, err := s.store.GetCharacter(ctx, id)
+	if !isNotFound(err) {
+		return ch, err
+	}
+	if s.negative.contains(id) {
+		return characters.Character{}, err
+	}
+
+	v, fetchErr, _ := s.group.DoContext(ctx, strconv.Itoa(id), fetchTimeout, func(ctx context.Context) (interface{}, error) {
+		return s.fetch(ctx, id)
+	})
+	switch {
+	case errors.Is(fetchErr, marvel.ErrNotFound):
+		return characters.Character{}, err
+	case fetchErr != nil:
+		return characters.Character{}, fetchErr
+	}
+	return v.(characters.Character), nil
+}
+
+func (s *ReadThroughStore) fetch(ctx context.Context, id int) (characters.Character, error) {
+	lg := loglib.GetLogger(ctx)
+
+	ch, err := s.fetcher.RetrieveCharacter(ctx, id)
+	if errors.Is(err, marvel.ErrNotFound) {
+		s.negative.add(id)
+		return characters.Character{}, err
+	}
+	if err != nil {
+		lg.ErrorF("[Read through] fetching character %d: %s", id, err)
+		return characters.Character{}, marvelError(err)
+	}
+
+	if err = s.save(ctx, characters.CharacterSlice{ch}); err != nil {
+		lg.ErrorF("[Read through] saving character %d: %s", id, err)
+		return characters.Character{}, err
+	}
+	lg.InfoF("[Read through] character %d fetched from marvel", id)
+	return ch, nil
+}
+
+// marvelError is the error of a failed call to Marvel: 503 Service Unavailable should Marvel be
+// rate limiting, unavailable or too slow, which is worth retrying, else 502 Bad Gateway
+func marvelError(err error) error {
+	var statusErr *marvel.StatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode == http.StatusServiceUnavailable),
+		errors.As(err, &netErr) && netErr.Timeout(),
+		errors.Is(err, context.DeadlineExceeded):
+		return &web.Error{Status: http.StatusServiceUnavailable, Code: "marvel_unavailable", Desc: "Marvel is unavailable, please try again later", Err: err}
+	}
+	return &web.Error{Status: http.StatusBadGateway, Code: "marvel_error", Desc: "Marvel answered with an error", Err: err}
+}
+
+func isNotFound(err error) bool {
+	webErr := web.TypecastError(err)
+	return webErr != nil && webErr.Status == http.StatusNotFound
+}
+
+// negativeCache remembers IDs known to be missing for a while
+type negativeCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	expires map[int]time.Time
+}
+
+func newNegativeCache(ttl time.Duration, maxEntries int) *negativeCache {
+	return &negativeCache{ttl: ttl, maxEntries: maxEntries, expires: make(map[int]time.Time)}
+}
+
+func (c *negativeCache) contains(id int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	exp, ok := c.expires[id]
+	if !ok {
+		return false
+	}
+	if time.Now().After(exp) {
+		delete(c.expires, id)
+		return false
+	}
+	return true
+}
+
+func (c *negativeCache) add(id int) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.expires) >= c.maxEntries {
+		now := time.Now()
+		for k, exp := range c.expires {
+			if now.After(exp) {
+				delete(c.expires, k)
+			}
+		}
+	}
+	// still full of live entries, make room by forgetting an arbitrary one
+	for k := range c.expires {
+		if len(c.expires) < c.maxEntries {
+			break
+		}
+		delete(c.expires, k)
+	}
+	c.expires[id] = time.Now().Add(c.ttl)
+}
@@ -0,0 +1,271 @@
+package characters
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/characters"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/web"
+	"github.com/kagelui/marvel-forwarder/internal/service/marvel"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+type mockReader struct {
+	getCharacterIDsFn func(ctx context.Context) ([]int, error)
+	getCharactersFn   func(ctx context.Context, fields ...characters.Field) ([]characters.Character, error)
+	getCharacterFn    func(ctx context.Context, id int) (characters.Character, error)
+	lastSyncedFn      func(ctx context.Context) (time.Time, error)
+}
+
+func (m mockReader) GetCharacterIDs(ctx context.Context) ([]int, error) {
+	if m.getCharacterIDsFn != nil {
+		return m.getCharacterIDsFn(ctx)
+	}
+	return nil, nil
+}
+
+func (m mockReader) GetCharacters(ctx context.Context, fields ...characters.Field) ([]characters.Character, error) {
+	if m.getCharactersFn != nil {
+		return m.getCharactersFn(ctx, fields...)
+	}
+	return nil, nil
+}
+
+func (m mockReader) LastSynced(ctx context.Context) (time.Time, error) {
+	if m.lastSyncedFn != nil {
+		return m.lastSyncedFn(ctx)
+	}
+	return time.Time{}, nil
+}
+
+func (m mockReader) GetCharacter(ctx context.Context, id int) (characters.Character, error) {
+	return m.getCharacterFn(ctx, id)
+}
+
+type mockFetcher func(ctx context.Context, id int) (characters.Character, error)
+
+func (f mockFetcher) RetrieveCharacter(ctx context.Context, id int) (characters.Character, error) {
+	return f(ctx, id)
+}
+
+var errNoSuchCharacter = &web.Error{Status: http.StatusNotFound, Code: "no_such_character", Desc: "no such character"}
+
+func TestReadThroughStore_GetCharacter(t *testing.T) {
+	daredevil := characters.Character{ID: 941356, Name: "Daredevil", Description: "some broke lawyer"}
+	missing := mockReader{getCharacterFn: func(ctx context.Context, id int) (characters.Character, error) {
+		return characters.Character{}, errNoSuchCharacter
+	}}
+
+	tests := []struct {
+		name       string
+		store      Reader
+		fetcher    characterFetcher
+		saveErr    error
+		want       characters.Character
+		wantErr    string
+		wantStatus int
+		wantSaved  characters.CharacterSlice
+	}{
+		{
+			name: "hit",
+			store: mockReader{getCharacterFn: func(ctx context.Context, id int) (characters.Character, error) {
+				return daredevil, nil
+			}},
+			fetcher: mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+				return characters.Character{}, fmt.Errorf("should not be called")
+			}),
+			want: daredevil,
+		},
+		{
+			name: "store error is not a miss",
+			store: mockReader{getCharacterFn: func(ctx context.Context, id int) (characters.Character, error) {
+				return characters.Character{}, fmt.Errorf("db down")
+			}},
+			fetcher: mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+				return daredevil, nil
+			}),
+			wantErr: "db down",
+		},
+		{
+			name:  "miss fetched from marvel",
+			store: missing,
+			fetcher: mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+				return daredevil, nil
+			}),
+			want:      daredevil,
+			wantSaved: characters.CharacterSlice{daredevil},
+		},
+		{
+			name:  "unknown to marvel",
+			store: missing,
+			fetcher: mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+				return characters.Character{}, marvel.ErrNotFound
+			}),
+			wantErr: "no such character",
+		},
+		{
+			name:  "marvel error",
+			store: missing,
+			fetcher: mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+				return characters.Character{}, &marvel.StatusError{StatusCode: http.StatusInternalServerError}
+			}),
+			wantErr:    "Marvel answered with an error",
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:  "marvel rate limiting",
+			store: missing,
+			fetcher: mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+				return characters.Character{}, &marvel.StatusError{StatusCode: http.StatusTooManyRequests}
+			}),
+			wantErr:    "Marvel is unavailable, please try again later",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:  "marvel too slow",
+			store: missing,
+			fetcher: mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+				return characters.Character{}, fmt.Errorf("get: %w", context.DeadlineExceeded)
+			}),
+			wantErr:    "Marvel is unavailable, please try again later",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:  "save error",
+			store: missing,
+			fetcher: mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+				return daredevil, nil
+			}),
+			saveErr:   fmt.Errorf("db down"),
+			wantErr:   "db down",
+			wantSaved: characters.CharacterSlice{daredevil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved characters.CharacterSlice
+			s := NewReadThroughStore(tt.store, nil, tt.fetcher, time.Minute)
+			s.save = func(ctx context.Context, chs characters.CharacterSlice) error {
+				saved = append(saved, chs...)
+				return tt.saveErr
+			}
+
+			got, err := s.GetCharacter(context.TODO(), daredevil.ID)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want, got)
+			}
+			if tt.wantStatus != 0 {
+				testutil.Equals(t, tt.wantStatus, web.TypecastError(err).Status)
+			}
+			testutil.Equals(t, tt.wantSaved, saved)
+		})
+	}
+}
+
+func TestReadThroughStore_GetCharacter_negativeCaching(t *testing.T) {
+	var calls int32
+	s := NewReadThroughStore(mockReader{getCharacterFn: func(ctx context.Context, id int) (characters.Character, error) {
+		return characters.Character{}, errNoSuchCharacter
+	}}, nil, mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+		atomic.AddInt32(&calls, 1)
+		return characters.Character{}, marvel.ErrNotFound
+	}), time.Minute)
+
+	for i := 0; i < 3; i++ {
+		_, err := s.GetCharacter(context.TODO(), 1)
+		testutil.CompareError(t, "no such character", err)
+	}
+	testutil.Equals(t, int32(1), atomic.LoadInt32(&calls))
+
+	_, err := s.GetCharacter(context.TODO(), 2)
+	testutil.CompareError(t, "no such character", err)
+	testutil.Equals(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestReadThroughStore_GetCharacter_coalescing(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	s := NewReadThroughStore(mockReader{getCharacterFn: func(ctx context.Context, id int) (characters.Character, error) {
+		return characters.Character{}, errNoSuchCharacter
+	}}, nil, mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return characters.Character{ID: id, Name: "Stick"}, nil
+	}), time.Minute)
+	s.save = func(ctx context.Context, chs characters.CharacterSlice) error {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	got := make([]characters.Character, 10)
+	errs := make([]error, 10)
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i], errs[i] = s.GetCharacter(context.TODO(), 186824)
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	testutil.Equals(t, int32(1), atomic.LoadInt32(&calls))
+	for i := range got {
+		testutil.Ok(t, errs[i])
+		testutil.Equals(t, "Stick", got[i].Name)
+	}
+}
+
+func TestReadThroughStore_GetCharacter_callerGone(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	s := NewReadThroughStore(mockReader{getCharacterFn: func(ctx context.Context, id int) (characters.Character, error) {
+		return characters.Character{}, errNoSuchCharacter
+	}}, nil, mockFetcher(func(ctx context.Context, id int) (characters.Character, error) {
+		close(started)
+		<-release
+		return characters.Character{ID: id, Name: "Stick"}, ctx.Err()
+	}), time.Minute)
+	s.save = func(ctx context.Context, chs characters.CharacterSlice) error {
+		return ctx.Err()
+	}
+
+	// the client whose request started the fetch disconnects
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := s.GetCharacter(ctx, 186824)
+		firstErr <- err
+	}()
+	<-started
+	other := make(chan error, 1)
+	go func() {
+		_, err := s.GetCharacter(context.Background(), 186824)
+		other <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	testutil.CompareError(t, context.Canceled.Error(), <-firstErr)
+
+	close(release)
+	testutil.Ok(t, <-other)
+}
+
+func TestNegativeCache(t *testing.T) {
+	c := newNegativeCache(time.Minute, 2)
+	c.add(1)
+	c.add(2)
+	c.add(3)
+	testutil.Equals(t, 2, len(c.expires))
+	testutil.Asserts(t, c.contains(3), "latest entry should be kept")
+
+	c = newNegativeCache(-time.Second, 2)
+	c.add(1)
+	testutil.Asserts(t, !c.contains(1), "non positive TTL disables the cache")
+}
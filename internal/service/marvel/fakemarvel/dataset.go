@@ -0,0 +1,114 @@
+package fakemarvel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const firstCharacterID = 1009000
+
+var (
+	namePrefixes = []string{"Captain", "Doctor", "Iron", "Black", "Silver", "Scarlet", "Ultimate", "Mister", "Phantom", "Crimson", "Invisible", "Moon"}
+	nameSuffixes = []string{"Man", "Woman", "Knight", "Widow", "Hawk", "Surfer", "Witch", "Fantastic", "Panther", "Storm", "Fist", "Girl"}
+	descriptions = []string{
+		"",
+		"A hero with a troubled past.",
+		"Some broke lawyer with a gift for hearing.",
+		"A villain with a plan that almost works.",
+		"Nobody quite knows where they came from.",
+	}
+	modifiedBase = time.Date(2014, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Character is a character served by the fake API
+type Character struct {
+	ID          int       `json:"ID"`
+	Name        string    `json:"Name"`
+	Description string    `json:"Description"`
+	Modified    time.Time `json:"-"`
+}
+
+// Dataset is an immutable, ID ordered set of characters
+type Dataset struct {
+	characters []Character
+	index      map[int]int
+}
+
+// NewDataset builds a Dataset from the given characters, dropping repeated IDs
+func NewDataset(chs []Character) *Dataset {
+	d := &Dataset{index: make(map[int]int, len(chs))}
+	for _, c := range chs {
+		if _, ok := d.index[c.ID]; ok {
+			continue
+		}
+		d.index[c.ID] = len(d.characters)
+		d.characters = append(d.characters, c)
+	}
+	sort.Slice(d.characters, func(i, j int) bool {
+		return d.characters[i].ID < d.characters[j].ID
+	})
+	for i, c := range d.characters {
+		d.index[c.ID] = i
+	}
+	return d
+}
+
+// GenerateDataset returns n characters derived deterministically from seed
+func GenerateDataset(seed int64, n int) *Dataset {
+	rnd := rand.New(rand.NewSource(seed))
+	chs := make([]Character, n)
+	id := firstCharacterID
+	for i := range chs {
+		id += 1 + rnd.Intn(10)
+		chs[i] = Character{
+			ID:          id,
+			Name:        fmt.Sprintf("%s %s %d", namePrefixes[rnd.Intn(len(namePrefixes))], nameSuffixes[rnd.Intn(len(nameSuffixes))], i),
+			Description: descriptions[rnd.Intn(len(descriptions))],
+			Modified:    modifiedBase.Add(time.Duration(rnd.Int63n(int64(5 * 365 * 24 * time.Hour)))).Truncate(time.Second),
+		}
+	}
+	return NewDataset(chs)
+}
+
+// LoadDataset reads a JSON array of characters, in the same shape as the characters
+// returned by serverd, e.g. internal/service/marvel/testdata/result.json
+func LoadDataset(r io.Reader) (*Dataset, error) {
+	var chs []Character
+	if err := json.NewDecoder(r).Decode(&chs); err != nil {
+		return nil, err
+	}
+	for i := range chs {
+		chs[i].Modified = modifiedBase
+	}
+	return NewDataset(chs), nil
+}
+
+// Total returns the number of characters in the dataset
+func (d *Dataset) Total() int {
+	return len(d.characters)
+}
+
+// Page returns at most limit characters starting from offset
+func (d *Dataset) Page(offset, limit int) []Character {
+	if offset >= len(d.characters) {
+		return []Character{}
+	}
+	end := offset + limit
+	if end > len(d.characters) {
+		end = len(d.characters)
+	}
+	return d.characters[offset:end]
+}
+
+// Get returns the character with the given ID
+func (d *Dataset) Get(id int) (Character, bool) {
+	i, ok := d.index[id]
+	if !ok {
+		return Character{}, false
+	}
+	return d.characters[i], true
+}
@@ -0,0 +1,57 @@
+package fakemarvel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestGenerateDataset(t *testing.T) {
+	a := GenerateDataset(42, 300)
+	b := GenerateDataset(42, 300)
+	c := GenerateDataset(43, 300)
+
+	testutil.Equals(t, 300, a.Total())
+	testutil.Equals(t, a.Page(0, 300), b.Page(0, 300))
+	testutil.Asserts(t, a.Page(0, 1)[0].Name != c.Page(0, 1)[0].Name || a.Page(0, 1)[0].ID != c.Page(0, 1)[0].ID, "different seeds should give different datasets")
+
+	page := a.Page(0, 300)
+	for i := 1; i < len(page); i++ {
+		testutil.Asserts(t, page[i-1].ID < page[i].ID, "characters should be ordered by ID")
+	}
+}
+
+func TestLoadDataset(t *testing.T) {
+	tests := []struct {
+		name    string
+		given   string
+		want    []Character
+		wantErr string
+	}{
+		{
+			name:    "malformed",
+			given:   `{"ID": 1}`,
+			wantErr: "cannot unmarshal object",
+		},
+		{
+			name:  "repeated IDs",
+			given: `[{"ID": 2, "Name": "Stick"}, {"ID": 1, "Name": "Daredevil", "Description": "some broke lawyer"}, {"ID": 2, "Name": "Kingpin"}]`,
+			want: []Character{
+				{ID: 1, Name: "Daredevil", Description: "some broke lawyer", Modified: modifiedBase},
+				{ID: 2, Name: "Stick", Modified: modifiedBase},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadDataset(strings.NewReader(tt.given))
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want, got.Page(0, 10))
+				_, ok := got.Get(2)
+				testutil.Asserts(t, ok, "character 2 should be found")
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package fakemarvel
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Faults configures the failures injected into the fake API responses
+type Faults struct {
+	// Latency is added to every request before it is answered
+	Latency time.Duration
+	// ErrorRate is the probability, between 0 and 1, of answering with a 500
+	ErrorRate float64
+	// ThrottleRate is the probability, between 0 and 1, of answering with a 429
+	ThrottleRate float64
+}
+
+type fault int
+
+const (
+	noFault fault = iota
+	serverErrorFault
+	throttleFault
+)
+
+type injector struct {
+	faults Faults
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newInjector(f Faults, seed int64) *injector {
+	return &injector{faults: f, rnd: rand.New(rand.NewSource(seed))}
+}
+
+// next sleeps for the configured latency and picks the fault of the current request
+func (i *injector) next() fault {
+	if i.faults.Latency > 0 {
+		time.Sleep(i.faults.Latency)
+	}
+
+	i.mu.Lock()
+	p := i.rnd.Float64()
+	i.mu.Unlock()
+
+	switch {
+	case p < i.faults.ThrottleRate:
+		return throttleFault
+	case p < i.faults.ThrottleRate+i.faults.ErrorRate:
+		return serverErrorFault
+	}
+	return noFault
+}
@@ -0,0 +1,226 @@
+// Package fakemarvel implements a local stand-in for the Marvel API, so that
+// development and tests do not need real keys nor network access
+package fakemarvel
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxLimit     = 100
+	defaultLimit = 20
+
+	modifiedLayout = "2006-01-02T15:04:05-0700"
+	attribution    = "Data provided by Marvel. © 2021 MARVEL"
+)
+
+// Config configures the fake API
+type Config struct {
+	// PublicKey and PrivateKey are used to validate the request hash,
+	// validation is skipped if PrivateKey is empty
+	PublicKey  string
+	PrivateKey string
+	Faults     Faults
+	// Seed seeds the fault injection
+	Seed int64
+}
+
+// Server serves a Dataset the same way the Marvel API does
+type Server struct {
+	cfg      Config
+	data     *Dataset
+	injector *injector
+	router   *mux.Router
+}
+
+// NewServer returns a Server serving the given dataset
+func NewServer(data *Dataset, cfg Config) *Server {
+	s := &Server{
+		cfg:      cfg,
+		data:     data,
+		injector: newInjector(cfg.Faults, cfg.Seed),
+		router:   mux.NewRouter(),
+	}
+	s.router.HandleFunc("/v1/public/characters", s.listCharacters).Methods(http.MethodGet)
+	s.router.HandleFunc("/v1/public/characters/{id}", s.getCharacter).Methods(http.MethodGet)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch s.injector.next() {
+	case throttleFault:
+		writeJSON(w, http.StatusTooManyRequests, errorResponse{Code: "RequestThrottled", Message: "You have exceeded your rate limit.  Please try again later."})
+		return
+	case serverErrorFault:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Code: "InternalError", Message: "Injected failure."})
+		return
+	}
+
+	if status, resp, ok := s.authenticate(r); !ok {
+		writeJSON(w, status, resp)
+		return
+	}
+
+	s.router.ServeHTTP(w, r)
+}
+
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type statusResponse struct {
+	Code   int    `json:"code"`
+	Status string `json:"status"`
+}
+
+type response struct {
+	Code            int          `json:"code"`
+	Status          string       `json:"status"`
+	Copyright       string       `json:"copyright"`
+	AttributionText string       `json:"attributionText"`
+	Etag            string       `json:"etag"`
+	Data            responseData `json:"data"`
+}
+
+type responseData struct {
+	Offset  int             `json:"offset"`
+	Limit   int             `json:"limit"`
+	Total   int             `json:"total"`
+	Count   int             `json:"count"`
+	Results []characterData `json:"results"`
+}
+
+type characterData struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Modified    string `json:"modified"`
+	ResourceURI string `json:"resourceURI"`
+}
+
+// authenticate validates the apikey, ts and hash parameters
+func (s *Server) authenticate(r *http.Request) (int, interface{}, bool) {
+	if s.cfg.PrivateKey == "" {
+		return 0, nil, true
+	}
+
+	q := r.URL.Query()
+	apiKey, ts, hash := q.Get("apikey"), q.Get("ts"), q.Get("hash")
+	switch {
+	case apiKey == "":
+		return http.StatusConflict, errorResponse{Code: "MissingParameter", Message: "You must provide a user key."}, false
+	case ts == "":
+		return http.StatusConflict, errorResponse{Code: "MissingParameter", Message: "You must provide a timestamp."}, false
+	case hash == "":
+		return http.StatusConflict, errorResponse{Code: "MissingParameter", Message: "You must provide a hash."}, false
+	case apiKey != s.cfg.PublicKey:
+		return http.StatusUnauthorized, errorResponse{Code: "InvalidCredentials", Message: "The passed API key is invalid."}, false
+	}
+
+	h := md5.New()
+	_, _ = io.WriteString(h, ts+s.cfg.PrivateKey+s.cfg.PublicKey)
+	if fmt.Sprintf("%x", h.Sum(nil)) != hash {
+		return http.StatusUnauthorized, errorResponse{Code: "InvalidCredentials", Message: "That hash, timestamp and key combination is invalid."}, false
+	}
+	return 0, nil, true
+}
+
+func (s *Server) listCharacters(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	offset, err := intParam(q.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeJSON(w, http.StatusConflict, statusResponse{Code: http.StatusConflict, Status: "You must pass a non-negative integer offset."})
+		return
+	}
+	limit, err := intParam(q.Get("limit"), defaultLimit)
+	switch {
+	case err != nil || limit < 1:
+		writeJSON(w, http.StatusConflict, statusResponse{Code: http.StatusConflict, Status: "You must pass an integer limit greater than 0."})
+		return
+	case limit > maxLimit:
+		writeJSON(w, http.StatusConflict, statusResponse{Code: http.StatusConflict, Status: fmt.Sprintf("You may not request more than %d items.", maxLimit)})
+		return
+	}
+
+	s.respond(w, r, offset, limit, s.data.Total(), s.data.Page(offset, limit))
+}
+
+func (s *Server) getCharacter(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, statusResponse{Code: http.StatusNotFound, Status: "We couldn't find that character"})
+		return
+	}
+	c, ok := s.data.Get(id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, statusResponse{Code: http.StatusNotFound, Status: "We couldn't find that character"})
+		return
+	}
+
+	s.respond(w, r, 0, defaultLimit, 1, []Character{c})
+}
+
+// respond writes the result page, or a 304 if the client already has it
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, offset, limit, total int, chs []Character) {
+	data := responseData{
+		Offset:  offset,
+		Limit:   limit,
+		Total:   total,
+		Count:   len(chs),
+		Results: make([]characterData, len(chs)),
+	}
+	for i, c := range chs {
+		data.Results[i] = characterData{
+			ID:          c.ID,
+			Name:        c.Name,
+			Description: c.Description,
+			Modified:    c.Modified.Format(modifiedLayout),
+			ResourceURI: fmt.Sprintf("http://%s/v1/public/characters/%d", r.Host, c.ID),
+		}
+	}
+
+	etag := dataEtag(data)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	writeJSON(w, http.StatusOK, response{
+		Code:            http.StatusOK,
+		Status:          "Ok",
+		Copyright:       fmt.Sprintf("© %d MARVEL", time.Now().Year()),
+		AttributionText: attribution,
+		Etag:            etag,
+		Data:            data,
+	})
+}
+
+func dataEtag(data responseData) string {
+	b, _ := json.Marshal(data)
+	return fmt.Sprintf("%x", sha1.Sum(b))
+}
+
+func intParam(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
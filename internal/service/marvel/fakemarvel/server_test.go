@@ -0,0 +1,168 @@
+package fakemarvel
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+const (
+	testPublicKey  = "006127f9ec4cdd9da3973a1090fa1a75"
+	testPrivateKey = "265d12b39c12c21e267f5cc97137d5b0"
+	// testHash is the hash of ts 8312573 with the test keys
+	testHash = "faac4afc7298a4230a8594b0bcc680ae"
+)
+
+func TestServer_listCharacters(t *testing.T) {
+	s := NewServer(GenerateDataset(1, 250), Config{PublicKey: testPublicKey, PrivateKey: testPrivateKey})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantOffset int
+		wantCount  int
+	}{
+		{
+			name:       "missing key",
+			query:      "ts=8312573&hash=" + testHash,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "wrong hash",
+			query:      "ts=8312574&apikey=" + testPublicKey + "&hash=" + testHash,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "limit too large",
+			query:      "ts=8312573&apikey=" + testPublicKey + "&hash=" + testHash + "&limit=101",
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "default page",
+			query:      "ts=8312573&apikey=" + testPublicKey + "&hash=" + testHash,
+			wantStatus: http.StatusOK,
+			wantOffset: 0,
+			wantCount:  defaultLimit,
+		},
+		{
+			name:       "last page",
+			query:      "ts=8312573&apikey=" + testPublicKey + "&hash=" + testHash + "&offset=200&limit=100",
+			wantStatus: http.StatusOK,
+			wantOffset: 200,
+			wantCount:  50,
+		},
+		{
+			name:       "beyond last page",
+			query:      "ts=8312573&apikey=" + testPublicKey + "&hash=" + testHash + "&offset=300&limit=100",
+			wantStatus: http.StatusOK,
+			wantOffset: 300,
+			wantCount:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/public/characters?"+tt.query, nil))
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var resp response
+			testutil.Ok(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			testutil.Equals(t, tt.wantOffset, resp.Data.Offset)
+			testutil.Equals(t, 250, resp.Data.Total)
+			testutil.Equals(t, tt.wantCount, resp.Data.Count)
+			testutil.Equals(t, tt.wantCount, len(resp.Data.Results))
+			testutil.Equals(t, resp.Etag, rr.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestServer_getCharacter(t *testing.T) {
+	data := GenerateDataset(1, 10)
+	s := NewServer(data, Config{})
+	existing := data.Page(3, 1)[0]
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/public/characters/1", nil))
+	testutil.Equals(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/public/characters/"+strconv.Itoa(existing.ID), nil))
+	testutil.Equals(t, http.StatusOK, rr.Code)
+
+	var resp response
+	testutil.Ok(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	testutil.Equals(t, 1, len(resp.Data.Results))
+	testutil.Equals(t, existing.ID, resp.Data.Results[0].ID)
+	testutil.Equals(t, existing.Name, resp.Data.Results[0].Name)
+}
+
+func TestServer_etag(t *testing.T) {
+	s := NewServer(GenerateDataset(1, 10), Config{})
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/public/characters", nil))
+	testutil.Equals(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	testutil.Asserts(t, etag != "", "etag should be set")
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/public/characters", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	testutil.Equals(t, http.StatusNotModified, rr.Code)
+	testutil.Equals(t, "", rr.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/public/characters?offset=5", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	testutil.Equals(t, http.StatusOK, rr.Code)
+}
+
+func TestServer_faults(t *testing.T) {
+	tests := []struct {
+		name       string
+		faults     Faults
+		wantStatus int
+	}{
+		{
+			name:       "no fault",
+			faults:     Faults{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "always throttled",
+			faults:     Faults{ThrottleRate: 1},
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:       "always failing",
+			faults:     Faults{ErrorRate: 1},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "slow",
+			faults:     Faults{Latency: 20 * time.Millisecond},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(GenerateDataset(1, 10), Config{Faults: tt.faults})
+			rr := httptest.NewRecorder()
+			start := time.Now()
+			s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/public/characters", nil))
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Asserts(t, time.Since(start) >= tt.faults.Latency, "latency should be injected")
+		})
+	}
+}
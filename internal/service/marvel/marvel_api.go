@@ -4,20 +4,46 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/kagelui/marvel-forwarder/internal/models/characters"
 	"github.com/kagelui/marvel-forwarder/internal/pkg/loglib"
+	"github.com/kagelui/marvel-forwarder/internal/pkg/metrics"
 )
 
 const (
 	apiLimit = 100
+	// defaultRetryInterval is the wait before the first retry when ApiClient.RetryInterval is not set
+	defaultRetryInterval = 5 * time.Second
+)
+
+// ErrNotFound is returned when the requested resource does not exist in the API
+var ErrNotFound = errors.New("not found in marvel API")
+
+// StatusError is returned for a response of the API other than 200 OK or 404 Not Found
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("result error: status %d", e.StatusCode)
+}
+
+var (
+	requestsTotal = metrics.NewCounter("marvel_requests_total",
+		"Requests to the Marvel API, per status code, error if none.", "status")
+	retriesTotal = metrics.NewCounter("marvel_retries_total",
+		"Requests to the Marvel API which were retries.")
+	pagesFetched = metrics.NewCounter("marvel_pages_fetched_total",
+		"Pages of characters fetched from the Marvel API.")
 )
 
 type ApiClient struct {
@@ -26,6 +52,8 @@ type ApiClient struct {
 	PrivateKey string
 	APIAddr    string
 	Retries    int
+	// RetryInterval is the wait before the first retry, doubling after each, defaultRetryInterval if 0
+	RetryInterval time.Duration
 }
 
 // RetrieveCharacters retrieves all the characters from the API
@@ -41,6 +69,7 @@ func (ac ApiClient) RetrieveCharacters(ctx context.Context) (characters.Characte
 	total := firstTrunk.Total
 	numConnections := total / apiLimit
 	var wg sync.WaitGroup
+	var mu sync.Mutex
 	var hasError bool
 	for i := 1; i <= numConnections; i++ {
 		wg.Add(1)
@@ -50,11 +79,13 @@ func (ac ApiClient) RetrieveCharacters(ctx context.Context) (characters.Characte
 			resp, err := ac.retrieveOneBatchCharacters(ctx, num*apiLimit, apiLimit)
 			if err != nil {
 				lg.ErrorF(err.Error())
-				hasError = true
 			}
 			newTrunk := responseToCharacters(resp)
 			lg.InfoF("runner %d received %d characters", num, len(newTrunk))
+			mu.Lock()
+			hasError = hasError || err != nil
 			result = append(result, newTrunk...)
+			mu.Unlock()
 			lg.InfoF("End runner %d", num)
 		}(i)
 	}
@@ -95,23 +126,60 @@ func (ac ApiClient) retrieveOneBatchCharacters(ctx context.Context, offset, limi
 	ts := time.Now().Unix()
 	hash := ac.requestHash(ts)
 	addr := fmt.Sprintf("%s?ts=%v&apikey=%s&hash=%s&offset=%d&limit=%d", ac.APIAddr, ts, ac.PublicKey, hash, offset, limit)
-	req, err := http.NewRequest(http.MethodGet, addr, nil)
+	rd, err := ac.get(ctx, addr)
+	if err == nil {
+		pagesFetched.Inc()
+	}
+	return rd, err
+}
+
+// RetrieveCharacter retrieves the character with the given ID from the API,
+// returning ErrNotFound should Marvel not know about it
+func (ac ApiClient) RetrieveCharacter(ctx context.Context, id int) (characters.Character, error) {
+	ts := time.Now().Unix()
+	hash := ac.requestHash(ts)
+	addr := fmt.Sprintf("%s/%d?ts=%v&apikey=%s&hash=%s", ac.APIAddr, id, ts, ac.PublicKey, hash)
+	rd, err := ac.get(ctx, addr)
+	if err != nil {
+		return characters.Character{}, err
+	}
+
+	chs := responseToCharacters(rd)
+	if len(chs) == 0 {
+		return characters.Character{}, ErrNotFound
+	}
+	return chs[0], nil
+}
+
+func (ac ApiClient) get(ctx context.Context, addr string) (responseData, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
 	if err != nil {
 		return responseData{}, err
 	}
 
 	var resp *http.Response
 	var e error
+	attempts := 0
 	if err := withRetries(ctx, func() error {
+		if attempts++; attempts > 1 {
+			retriesTotal.Inc()
+		}
 		resp, e = ac.Client.Do(req)
 		if e != nil {
+			requestsTotal.Inc("error")
 			return e
 		}
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("result error")
+		requestsTotal.Inc(strconv.Itoa(resp.StatusCode))
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return nil
+		case http.StatusNotFound:
+			closeBody(resp)
+			return backoff.Permanent(ErrNotFound)
 		}
-		return nil
-	}, ac.Retries); err != nil {
+		closeBody(resp)
+		return &StatusError{StatusCode: resp.StatusCode}
+	}, ac.Retries, ac.RetryInterval); err != nil {
 		return responseData{}, err
 	}
 
@@ -129,15 +197,24 @@ func (ac ApiClient) retrieveOneBatchCharacters(ctx context.Context, offset, limi
 	return r.Data, nil
 }
 
+func closeBody(resp *http.Response) {
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+}
+
 func (ac ApiClient) requestHash(ts int64) string {
 	h := md5.New()
 	_, _ = io.WriteString(h, fmt.Sprintf("%v%v%v", ts, ac.PrivateKey, ac.PublicKey))
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
-func withRetries(ctx context.Context, callback func() error, retries int) error {
+func withRetries(ctx context.Context, callback func() error, retries int, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultRetryInterval
+	}
 	b := backoff.NewExponentialBackOff()
-	b.InitialInterval = 5 * time.Second
+	b.InitialInterval = interval
 	b.RandomizationFactor = 0
 	b.MaxElapsedTime = time.Minute
 	bo := backoff.WithContext(backoff.WithMaxRetries(b, uint64(retries)), ctx)
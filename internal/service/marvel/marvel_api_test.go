@@ -7,10 +7,14 @@ import (
 	"github.com/kagelui/marvel-forwarder/internal/models/characters"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/kagelui/marvel-forwarder/internal/service/marvel/fakemarvel"
 	"github.com/kagelui/marvel-forwarder/internal/testutil"
 )
 
@@ -272,3 +276,116 @@ func sortCharacters(characters []characters.Character) []characters.Character {
 	})
 	return characters
 }
+
+func TestApiClient_RetrieveCharacters_fakeMarvel(t *testing.T) {
+	data := fakemarvel.GenerateDataset(7, 1234)
+	srv := httptest.NewServer(fakemarvel.NewServer(data, fakemarvel.Config{
+		PublicKey:  "006127f9ec4cdd9da3973a1090fa1a75",
+		PrivateKey: "265d12b39c12c21e267f5cc97137d5b0",
+	}))
+	defer srv.Close()
+
+	ac := ApiClient{
+		Client:     srv.Client(),
+		PublicKey:  "006127f9ec4cdd9da3973a1090fa1a75",
+		PrivateKey: "265d12b39c12c21e267f5cc97137d5b0",
+		APIAddr:    srv.URL + "/v1/public/characters",
+	}
+	got, err := ac.RetrieveCharacters(context.TODO())
+	testutil.Ok(t, err)
+
+	want := make([]characters.Character, 0, data.Total())
+	for _, c := range data.Page(0, data.Total()) {
+		want = append(want, characters.Character{ID: c.ID, Name: c.Name, Description: c.Description})
+	}
+	testutil.Equals(t, want, sortCharacters(got))
+}
+
+func TestApiClient_RetrieveCharacter(t *testing.T) {
+	data := fakemarvel.GenerateDataset(7, 20)
+	existing := data.Page(5, 1)[0]
+	srv := httptest.NewServer(fakemarvel.NewServer(data, fakemarvel.Config{
+		PublicKey:  "006127f9ec4cdd9da3973a1090fa1a75",
+		PrivateKey: "265d12b39c12c21e267f5cc97137d5b0",
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		privateKey string
+		id         int
+		want       characters.Character
+		wantErr    string
+	}{
+		{
+			name:       "found",
+			privateKey: "265d12b39c12c21e267f5cc97137d5b0",
+			id:         existing.ID,
+			want:       characters.Character{ID: existing.ID, Name: existing.Name, Description: existing.Description},
+		},
+		{
+			name:       "not found",
+			privateKey: "265d12b39c12c21e267f5cc97137d5b0",
+			id:         1,
+			wantErr:    ErrNotFound.Error(),
+		},
+		{
+			name:       "wrong key",
+			privateKey: "--",
+			id:         existing.ID,
+			wantErr:    "result error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ac := ApiClient{
+				Client:     srv.Client(),
+				PublicKey:  "006127f9ec4cdd9da3973a1090fa1a75",
+				PrivateKey: tt.privateKey,
+				APIAddr:    srv.URL + "/v1/public/characters",
+			}
+			got, err := ac.RetrieveCharacter(context.TODO(), tt.id)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApiClient_RetrieveCharacter_context(t *testing.T) {
+	// Marvel hangs until the request is given up
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ac := ApiClient{Client: srv.Client(), APIAddr: srv.URL, Retries: 0}
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := ac.RetrieveCharacter(ctx, 1)
+	testutil.CompareError(t, "context deadline exceeded", err)
+	testutil.Asserts(t, time.Since(start) < 5*time.Second, "the call should end with its context, took %s", time.Since(start))
+}
+
+func TestApiClient_RetrieveCharacter_retryInterval(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":200,"data":{"results":[{"id":1,"name":"one"}]}}`))
+	}))
+	defer srv.Close()
+
+	ac := ApiClient{Client: srv.Client(), APIAddr: srv.URL, Retries: 1, RetryInterval: 10 * time.Millisecond}
+	start := time.Now()
+	ch, err := ac.RetrieveCharacter(context.TODO(), 1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, characters.Character{ID: 1, Name: "one"}, ch)
+	testutil.Equals(t, int32(2), calls)
+	testutil.Asserts(t, time.Since(start) < defaultRetryInterval, "the retry should wait RetryInterval, took %s", time.Since(start))
+}
@@ -0,0 +1,228 @@
+// Package snapshot exports the mirrored catalogue to a directory and imports it back, e.g. to seed
+// a new environment or to roll back a bad sync without calling Marvel.
+//
+// A snapshot is a manifest.json listing the resources, each kept as NDJSON in its own file along
+// with its count and SHA-256, and the sync the catalogue was exported at
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/characters"
+)
+
+const (
+	// Version is the version of the format written by Export, Import refuses any other
+	Version = 1
+
+	// ManifestFile is the name of the manifest in the directory of a snapshot
+	ManifestFile = "manifest.json"
+
+	// ResourceCharacters is the resource of the characters
+	ResourceCharacters = "characters"
+)
+
+// Manifest describes a snapshot
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Watermark is the latest sync at the time of the export, nil should there have been none
+	Watermark *Watermark `json:"watermark"`
+	// Resources are the files of the snapshot, by resource
+	Resources map[string]Resource `json:"resources"`
+}
+
+// Watermark is the sync the exported catalogue comes from
+type Watermark struct {
+	SyncID         int       `json:"sync_id"`
+	CharacterCount int       `json:"character_count"`
+	CompletedAt    time.Time `json:"completed_at"`
+}
+
+// Resource is a file of NDJSON records
+type Resource struct {
+	File   string `json:"file"`
+	Count  int    `json:"count"`
+	SHA256 string `json:"sha256"`
+}
+
+// character is a record of the characters resource
+type character struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Export writes the catalogue of repo to dir, which is created if need be. The manifest is written last,
+// so that a directory without one is an export which did not complete
+func Export(ctx context.Context, repo characters.Repository, dir string) (Manifest, error) {
+	m := Manifest{Version: Version, CreatedAt: time.Now().UTC(), Resources: map[string]Resource{}}
+
+	// the watermark must be the sync of the characters exported
+	c, err := repo.GetCatalogue(ctx)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if s := c.Sync; s != nil {
+		m.Watermark = &Watermark{SyncID: s.ID, CharacterCount: s.CharacterCount, CompletedAt: s.CompletedAt}
+	}
+	chs := c.Characters
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return Manifest{}, err
+	}
+	// a manifest left by a previous export would describe files about to be replaced
+	if err = os.Remove(filepath.Join(dir, ManifestFile)); err != nil && !os.IsNotExist(err) {
+		return Manifest{}, err
+	}
+
+	res, err := writeResource(dir, ResourceCharacters+".ndjson", len(chs), func(enc *json.Encoder) error {
+		for _, ch := range chs {
+			if err := enc.Encode(character{ID: ch.ID, Name: ch.Name, Description: ch.Description}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+	m.Resources[ResourceCharacters] = res
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, ManifestFile), append(b, '\n'), 0644); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+// writeResource writes the count records encoded by fn to the file, hashing them along the way
+func writeResource(dir, file string, count int, fn func(enc *json.Encoder) error) (Resource, error) {
+	f, err := os.Create(filepath.Join(dir, file))
+	if err != nil {
+		return Resource{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, h))
+	if err = fn(json.NewEncoder(w)); err != nil {
+		return Resource{}, err
+	}
+	if err = w.Flush(); err != nil {
+		return Resource{}, err
+	}
+	if err = f.Close(); err != nil {
+		return Resource{}, err
+	}
+	return Resource{File: file, Count: count, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Read reads and checks the snapshot in dir: its version, and the count and checksum of every resource
+func Read(dir string) (Manifest, characters.CharacterSlice, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+	var m Manifest
+	if err = json.Unmarshal(b, &m); err != nil {
+		return Manifest{}, nil, fmt.Errorf("%s: %v", ManifestFile, err)
+	}
+	if m.Version != Version {
+		return Manifest{}, nil, fmt.Errorf("%s: version %d is not supported, only %d is", ManifestFile, m.Version, Version)
+	}
+	// a resource unknown to this version would be lost silently
+	for name := range m.Resources {
+		if name != ResourceCharacters {
+			return Manifest{}, nil, fmt.Errorf("%s: unknown resource %q", ManifestFile, name)
+		}
+	}
+	res, ok := m.Resources[ResourceCharacters]
+	if !ok {
+		return Manifest{}, nil, fmt.Errorf("%s: resource %q missing", ManifestFile, ResourceCharacters)
+	}
+
+	chs := make(characters.CharacterSlice, 0, res.Count)
+	err = readResource(dir, res, func(dec *json.Decoder) error {
+		var ch character
+		if err := dec.Decode(&ch); err != nil {
+			return err
+		}
+		chs = append(chs, characters.Character{ID: ch.ID, Name: ch.Name, Description: ch.Description})
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+	return m, chs, nil
+}
+
+// readResource decodes every record of the resource with fn, checking the count and the checksum
+func readResource(dir string, res Resource, fn func(dec *json.Decoder) error) error {
+	// the file is named by the manifest, which must not point out of the snapshot
+	if res.File != filepath.Base(res.File) {
+		return fmt.Errorf("%s: invalid file %q", ManifestFile, res.File)
+	}
+	f, err := os.Open(filepath.Join(dir, res.File))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	scanner := bufio.NewScanner(io.TeeReader(f, h))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	count := 0
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.DisallowUnknownFields()
+		if err = fn(dec); err != nil {
+			return fmt.Errorf("%s:%d: %v", res.File, n, err)
+		}
+		if dec.More() {
+			return fmt.Errorf("%s:%d: more than one record", res.File, n)
+		}
+		count++
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", res.File, err)
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != res.SHA256 {
+		return fmt.Errorf("%s: checksum mismatch, got %s, want %s", res.File, sum, res.SHA256)
+	}
+	if count != res.Count {
+		return fmt.Errorf("%s: %d records, want %d", res.File, count, res.Count)
+	}
+	return nil
+}
+
+// Import replaces the catalogue of repo with the snapshot in dir, recording a sync of it,
+// once the whole snapshot has been read and checked
+func Import(ctx context.Context, repo characters.Repository, dir string) (Manifest, error) {
+	m, chs, err := Read(dir)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err = repo.ReplaceSync(ctx, chs); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
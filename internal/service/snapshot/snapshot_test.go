@@ -0,0 +1,142 @@
+package snapshot
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kagelui/marvel-forwarder/internal/models/characters"
+	"github.com/kagelui/marvel-forwarder/internal/testutil"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.TODO()
+	dir, err := ioutil.TempDir("", "snapshot")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	src := characters.NewMemory()
+	testutil.Ok(t, src.SaveSync(ctx, characters.CharacterSlice{
+		{ID: 831624, Name: "woman", Description: "line\nbreak"},
+		{ID: 9312, Name: "man", Description: "man0"},
+	}))
+
+	m, err := Export(ctx, src, dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, Version, m.Version)
+	testutil.Equals(t, 1, m.Watermark.SyncID)
+	testutil.Equals(t, 2, m.Watermark.CharacterCount)
+	testutil.Equals(t, 2, m.Resources[ResourceCharacters].Count)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "characters.ndjson"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"id":9312,"name":"man","description":"man0"}
+{"id":831624,"name":"woman","description":"line\nbreak"}
+`, string(b))
+
+	// the snapshot replaces whatever was there
+	dst := characters.NewMemory()
+	testutil.Ok(t, dst.SaveCharacters(ctx, characters.CharacterSlice{{ID: 1, Name: "gone"}}))
+	imported, err := Import(ctx, dst, dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, m.Watermark.CompletedAt.Unix(), imported.Watermark.CompletedAt.Unix())
+
+	want, err := src.GetCharacters(ctx)
+	testutil.Ok(t, err)
+	got, err := dst.GetCharacters(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, want, got)
+	s, err := dst.LatestSync(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, s.CharacterCount)
+}
+
+func TestExport_noSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := Export(context.TODO(), characters.NewMemory(), filepath.Join(dir, "new"))
+	testutil.Ok(t, err)
+	testutil.Asserts(t, m.Watermark == nil, "there should be no watermark, got %+v", m.Watermark)
+
+	_, chs, err := Read(filepath.Join(dir, "new"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(chs))
+}
+
+func TestRead_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest func(m string) string
+		records  string
+		err      string
+	}{
+		{
+			name:     "version",
+			manifest: func(m string) string { return strings.Replace(m, `"version": 1`, `"version": 2`, 1) },
+			err:      "manifest.json: version 2 is not supported, only 1 is",
+		},
+		{
+			name:     "unknown resource",
+			manifest: func(m string) string { return strings.Replace(m, `"characters": {`, `"comics": {`, 1) },
+			err:      `manifest.json: unknown resource "comics"`,
+		},
+		{
+			name:     "file out of the snapshot",
+			manifest: func(m string) string { return strings.Replace(m, `"characters.ndjson"`, `"../characters.ndjson"`, 1) },
+			err:      `manifest.json: invalid file "../characters.ndjson"`,
+		},
+		{
+			name:    "checksum",
+			records: `{"id":1,"name":"one","description":"changed"}` + "\n",
+			err:     "characters.ndjson: checksum mismatch",
+		},
+		{
+			name:    "malformed record",
+			records: `{"id":1,"name":"one","description":""}` + "\n" + `{"id":"2"}` + "\n",
+			err:     "characters.ndjson:2: json: cannot unmarshal string",
+		},
+		{
+			name:    "unknown field",
+			records: `{"id":1,"name":"one","description":"","comics":[]}` + "\n",
+			err:     `characters.ndjson:1: json: unknown field "comics"`,
+		},
+		{
+			name:     "count",
+			manifest: func(m string) string { return strings.Replace(m, `"count": 1`, `"count": 2`, 1) },
+			err:      "characters.ndjson: 1 records, want 2",
+		},
+		{
+			name: "ok",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "snapshot")
+			testutil.Ok(t, err)
+			defer os.RemoveAll(dir)
+
+			repo := characters.NewMemory()
+			testutil.Ok(t, repo.SaveSync(context.TODO(), characters.CharacterSlice{{ID: 1, Name: "one"}}))
+			_, err = Export(context.TODO(), repo, dir)
+			testutil.Ok(t, err)
+
+			if tt.manifest != nil {
+				path := filepath.Join(dir, ManifestFile)
+				b, err := ioutil.ReadFile(path)
+				testutil.Ok(t, err)
+				testutil.Ok(t, ioutil.WriteFile(path, []byte(tt.manifest(string(b))), 0644))
+			}
+			if tt.records != "" {
+				testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "characters.ndjson"), []byte(tt.records), 0644))
+			}
+
+			_, _, err = Read(dir)
+			testutil.CompareError(t, tt.err, err)
+		})
+	}
+}
@@ -1,3 +1,4 @@
 #!/bin/sh
 
-./bifrost
+# the pending migrations are applied first, so that the sync runs on a fresh DB
+./bifrost -migrate